@@ -0,0 +1,147 @@
+package kongplete
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/posener/complete"
+)
+
+const (
+	envLine  = "COMP_LINE"
+	envPoint = "COMP_POINT"
+	// envInlineFiles is set by scripts for shells that can't complete paths themselves. Paths are then written as
+	// candidates instead of a "files" or "dirs" directive.
+	envInlineFiles = "KONGPLETE_INLINE_FILES"
+)
+
+// The code below is adapted from https://github.com/posener/complete/blob/v1.2.3/complete.go
+// and https://github.com/posener/complete/blob/v1.2.3/args.go where it is unexported.
+
+// compLine returns the part of COMP_LINE before COMP_POINT. ok is false when COMP_LINE isn't set.
+func compLine() (line string, ok bool) {
+	line = os.Getenv(envLine)
+	if line == "" {
+		return "", false
+	}
+	point, err := strconv.Atoi(os.Getenv(envPoint))
+	if err != nil {
+		complete.Log("Failed parsing point %s: %v", os.Getenv(envPoint), err)
+		point = len(line)
+	}
+	if point >= 0 && point < len(line) {
+		line = line[:point]
+	}
+	return line, true
+}
+
+func newArgs(line string) complete.Args {
+	var (
+		all       []string
+		completed []string
+	)
+	parts := splitFields(line)
+	if len(parts) > 0 {
+		all = parts[1:]
+		completed = removeLast(parts[1:])
+	}
+	return complete.Args{
+		All:           all,
+		Completed:     completed,
+		Last:          last(parts),
+		LastCompleted: last(completed),
+	}
+}
+
+// newArgsFromWords returns Args for the words after the program name. The last word is the one being completed.
+func newArgsFromWords(words []string) complete.Args {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	all := splitFlagValue(append([]string{}, words...))
+	completed := removeLast(all)
+	return complete.Args{
+		All:           all,
+		Completed:     completed,
+		Last:          last(all),
+		LastCompleted: last(completed),
+	}
+}
+
+// splitFields returns a list of fields from the given command line.
+// If the last character is space, it appends an empty field in the end
+// indicating that the field before it was completed.
+// If the last field is a long flag with a value, like "--flag=value", it splits it to two fields: "--flag",
+// "value", so the value can be completed.
+func splitFields(line string) []string {
+	parts := strings.Fields(line)
+
+	// Add empty field if the last field was completed.
+	if len(line) > 0 && unicode.IsSpace(rune(line[len(line)-1])) {
+		parts = append(parts, "")
+	}
+
+	// Treat the last field if it is of the form "--flag=value"
+	parts = splitFlagValue(parts)
+	return parts
+}
+
+func splitFlagValue(line []string) []string {
+	if len(line) == 0 {
+		return line
+	}
+	prefix := flagValuePrefix(line[len(line)-1])
+	if prefix == "" {
+		return line
+	}
+	value := strings.TrimPrefix(line[len(line)-1], prefix)
+	return append(line[:len(line)-1], strings.TrimSuffix(prefix, "="), value)
+}
+
+// flagValuePrefix returns the "--flag=" part of field when it is a long flag with a value, like "--flag=value",
+// and "" otherwise.
+func flagValuePrefix(field string) string {
+	i := strings.Index(field, "=")
+	if i < 3 || !strings.HasPrefix(field, "--") {
+		return ""
+	}
+	return field[:i+1]
+}
+
+// lastField returns the field being completed in line.
+func lastField(line string) string {
+	if len(line) == 0 || unicode.IsSpace(rune(line[len(line)-1])) {
+		return ""
+	}
+	return last(strings.Fields(line))
+}
+
+// argsFrom returns a copy of Args of all arguments after the i'th argument.
+func argsFrom(a complete.Args, i int) complete.Args {
+	if i >= len(a.All) {
+		i = len(a.All) - 1
+	}
+	a.All = a.All[i+1:]
+
+	if i >= len(a.Completed) {
+		i = len(a.Completed) - 1
+	}
+	a.Completed = a.Completed[i+1:]
+	return a
+}
+
+func removeLast(a []string) []string {
+	if len(a) > 0 {
+		return a[:len(a)-1]
+	}
+	return a
+}
+
+func last(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[len(args)-1]
+}
@@ -0,0 +1,58 @@
+package kongplete
+
+import (
+	"github.com/posener/complete"
+)
+
+// Candidate is a completion candidate with an optional description. Shells that can show descriptions, like
+// zsh and fish, display the description next to the value. Shells that can group candidates, like zsh, show
+// candidates with the same Group together under it.
+type Candidate struct {
+	Value       string
+	Description string
+	Group       string
+}
+
+// DescribedPredictor is a complete.Predictor that can also describe its predictions.
+type DescribedPredictor interface {
+	complete.Predictor
+	PredictDescribed(a complete.Args) []Candidate
+}
+
+// PredictCandidates is like complete.PredictSet, but with descriptions.
+func PredictCandidates(candidates ...Candidate) DescribedPredictor {
+	return predictCandidates(candidates)
+}
+
+type predictCandidates []Candidate
+
+// Predict implements complete.Predictor
+func (p predictCandidates) Predict(complete.Args) []string {
+	values := make([]string, len(p))
+	for i, c := range p {
+		values[i] = c.Value
+	}
+	return values
+}
+
+// PredictDescribed implements DescribedPredictor
+func (p predictCandidates) PredictDescribed(complete.Args) []Candidate {
+	return p
+}
+
+// describedPredictions returns a predictor's predictions as candidates. Only a DescribedPredictor's candidates
+// have descriptions.
+func describedPredictions(predictor complete.Predictor, a complete.Args) []Candidate {
+	if predictor == nil {
+		return nil
+	}
+	if dp, ok := predictor.(DescribedPredictor); ok {
+		return dp.PredictDescribed(a)
+	}
+	predictions := predictor.Predict(a)
+	candidates := make([]Candidate, len(predictions))
+	for i, prediction := range predictions {
+		candidates[i] = Candidate{Value: prediction}
+	}
+	return candidates
+}
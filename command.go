@@ -0,0 +1,244 @@
+package kongplete
+
+import (
+	"strings"
+
+	"github.com/posener/complete"
+	"github.com/willabides/kongplete/internal/positionalpredictor"
+)
+
+// command is the completion model for a kong node. It mirrors complete.Command, but it can
+// recognise sub-command names without suggesting them.
+type command struct {
+	parent *command
+	// sub maps sub-command names and aliases to their commands.
+	sub map[string]*command
+	// subNames are the sub-command names to suggest.
+	subNames []Candidate
+	// flags maps flag names with hyphens to their value predictors.
+	flags complete.Flags
+	// flagNames are the flag names to suggest.
+	flagNames []Candidate
+	args      *positionalpredictor.PositionalPredictor
+	// passthrough is true when everything after the command is a positional argument.
+	passthrough bool
+}
+
+// flag returns the predictor for a flag of c or its ancestors.
+func (c *command) flag(name string) (complete.Predictor, bool) {
+	for cmd := c; cmd != nil; cmd = cmd.parent {
+		if predictor, ok := cmd.flags[name]; ok {
+			return predictor, true
+		}
+	}
+	return nil, false
+}
+
+// predictShortFlagArg predicts the argument attached to the last flag in a short flag cluster like "-vu<TAB>".
+// The predictions include the cluster.
+func (c *command) predictShortFlagArg(a complete.Args) []Candidate {
+	flag, arg, ok := c.args.ShortFlagArg(a.Last)
+	if !ok {
+		return nil
+	}
+	predictor, ok := c.flag(flag)
+	if !ok || predictor == nil {
+		return nil
+	}
+	cluster := a.Last[:len(a.Last)-len(arg)]
+	a.Last = arg
+	var candidates []Candidate
+	for _, candidate := range describedPredictions(predictor, a) {
+		candidate.Value = cluster + candidate.Value
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// predictFlagNames is adapted from complete.Flags' Predict method. Flag names are only suggested when the last
+// arg starts with a hyphen.
+func (c *command) predictFlagNames(a complete.Args) []Candidate {
+	if a.Last == "" || a.Last[0] != '-' {
+		return nil
+	}
+	return c.flagNames
+}
+
+// predictArgs predicts positional arguments.
+func (c *command) predictArgs(a complete.Args) prediction {
+	predictor, a := c.args.Predictor(a)
+	return predictValues(predictor, a)
+}
+
+// completeCommand converts c to a complete.Command. complete.Command suggests every name it recognises,
+// so hidden aliases are suggested by the result.
+func (c *command) completeCommand() complete.Command {
+	cmd := complete.Command{
+		Sub:         complete.Commands{},
+		GlobalFlags: c.flags,
+		Args:        c.args,
+	}
+	for name, sub := range c.sub {
+		cmd.Sub[name] = sub.completeCommand()
+	}
+	return cmd
+}
+
+// predict is adapted from complete.Command's predict method.
+// only is set to true if no more options are allowed to be returned.
+func (c *command) predict(a complete.Args) (p prediction, only bool) {
+	// search sub commands for predictions first
+	subCommandFound := false
+	for i, arg := range a.Completed {
+		sub, ok := c.sub[arg]
+		if !ok {
+			continue
+		}
+		subCommandFound = true
+		p, only = sub.predict(argsFrom(a, i))
+		if only {
+			return p, only
+		}
+		// We matched so stop searching. Continuing to search can accidentally
+		// match a subcommand with current set of commands.
+		break
+	}
+
+	// after "--" or once a passthrough argument has started, only positional arguments are left
+	if !subCommandFound && (c.passthrough || c.args.EndOfFlags(a)) {
+		complete.Log("Predicting positional arguments only")
+		return c.predictArgs(a), true
+	}
+
+	// if last completed word is a flag that we need to complete
+	if predictor, ok := c.flags[a.LastCompleted]; ok && predictor != nil {
+		complete.Log("Predicting according to flag %s", a.LastCompleted)
+		return predictValues(predictor, a), true
+	}
+
+	p.candidates = append(p.candidates, c.predictFlagNames(a)...)
+
+	// if a sub command was entered, we won't add the parent command
+	// completions and we return here.
+	if subCommandFound {
+		return p, false
+	}
+
+	// if last completed word is a short flag cluster ending with a flag that we need to complete
+	if flag, arg, ok := c.args.ShortFlagArg(a.LastCompleted); ok && arg == "" {
+		if predictor, ok := c.flag(flag); ok && predictor != nil {
+			complete.Log("Predicting according to flag %s in %s", flag, a.LastCompleted)
+			return predictValues(predictor, a), true
+		}
+	}
+
+	p.candidates = append(p.candidates, c.subNames...)
+	p.candidates = append(p.candidates, c.predictShortFlagArg(a)...)
+	p.add(c.predictArgs(a))
+	return p, false
+}
+
+// prediction is the result of predicting the last arg.
+type prediction struct {
+	candidates []Candidate
+	// files is set when the last arg is a path. Shells that complete paths themselves complete it instead, so
+	// its predictions aren't in candidates.
+	files *filesPredictor
+	// filesArgs are the args to predict files with.
+	filesArgs  complete.Args
+	directives Directive
+}
+
+// predictValues predicts the last arg with a value predictor.
+func predictValues(predictor complete.Predictor, a complete.Args) prediction {
+	switch p := predictor.(type) {
+	case *filesPredictor:
+		return prediction{files: p, filesArgs: a}
+	case *directivePredictor:
+		prediction := predictValues(p.Predictor, a)
+		prediction.directives |= p.directive
+		prediction.filesArgs = a
+		return prediction
+	case *elementsPredictor:
+		prefix, ea, present := p.split(a)
+		prediction := predictValues(p.predictor, ea)
+		if prefix == "" {
+			return prediction
+		}
+		prediction.candidates = p.prefixed(prediction.inlineFiles(), prefix, present)
+		return prediction
+	case *mapPredictor:
+		key, va, ok := p.split(a)
+		if !ok {
+			return prediction{candidates: p.predictKeys(a)}
+		}
+		prediction := predictValues(p.valuePredictor(key), va)
+		prediction.candidates = withPrefix(prediction.inlineFiles(), key+"=")
+		return prediction
+	case DirectivePredictor:
+		return prediction{
+			candidates: describedPredictions(predictor, a),
+			filesArgs:  a,
+			directives: p.PredictDirective(a),
+		}
+	}
+	return prediction{candidates: describedPredictions(predictor, a)}
+}
+
+// add adds the candidates, files and directives of other to p.
+func (p *prediction) add(other prediction) {
+	p.candidates = append(p.candidates, other.candidates...)
+	if other.pathPredictor() != nil {
+		p.files, p.filesArgs = other.files, other.filesArgs
+	}
+	p.directives |= other.directives
+}
+
+// pathPredictor returns the predictor for the paths shells complete themselves or nil when they don't.
+func (p *prediction) pathPredictor() *filesPredictor {
+	switch {
+	case p.files != nil:
+		return p.files
+	case p.directives&DirectiveDirs != 0:
+		return newFilesPredictor("*", true)
+	case p.directives&DirectiveFiles != 0:
+		return newFilesPredictor("*", false)
+	}
+	return nil
+}
+
+// allCandidates returns the candidates along with the predicted files.
+func (p *prediction) allCandidates() []Candidate {
+	files := p.pathPredictor()
+	if files == nil {
+		return p.candidates
+	}
+	candidates := make([]Candidate, 0, len(p.candidates))
+	candidates = append(candidates, p.candidates...)
+	return append(candidates, describedPredictions(files, p.filesArgs)...)
+}
+
+// inlineFiles returns the candidates along with the predicted files and stops shells from completing paths.
+// Shells complete paths from the start of the arg, so paths after a prefix like "a," or "key=" are candidates.
+func (p *prediction) inlineFiles() []Candidate {
+	candidates := p.allCandidates()
+	p.files = nil
+	p.directives &^= DirectiveFiles | DirectiveDirs
+	return candidates
+}
+
+// directive returns the directive for the rich format. It is made of words separated by spaces in this order:
+// "nospace", "nofallback" and "files PATTERN" or "dirs PATTERN", where PATTERN is the rest of the line.
+func (p *prediction) directive() string {
+	var words []string
+	if p.directives&DirectiveNoSpace != 0 {
+		words = append(words, "nospace")
+	}
+	if p.directives&DirectiveNoFallback != 0 {
+		words = append(words, "nofallback")
+	}
+	if files := p.pathPredictor(); files != nil {
+		words = append(words, files.directive())
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,56 @@
+package kongplete
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// CompletionCmd is a kong command that prints a standalone completion script for a shell, like
+// "source <(app completion zsh)". kong rejects flags that collide with the application's own flags, so an
+// application with its own --name or --bin flag can prefix these by embedding CompletionCmd in its command with a
+// prefix tag:
+//
+//	Completion struct {
+//		kongplete.CompletionCmd `embed:"" prefix:"completion-"`
+//	} `cmd:""`
+type CompletionCmd struct {
+	Shell shellFlag `arg:"" help:"Shell to print the completion script for."`
+	Name  string    `help:"Command name to complete. Defaults to the application name."`
+	Bin   string    `help:"Name or path of the binary the script runs for completions. Defaults to the path of this binary."`
+}
+
+// BeforeApply prints the completion script for the selected shell.
+func (c *CompletionCmd) BeforeApply(ctx *kong.Context) error {
+	traceValues(ctx, &c.Shell, &c.Name, &c.Bin)
+	// Without a shell, leave it to kong to report the missing argument.
+	if c.Shell == "" {
+		return nil
+	}
+	shell := string(c.Shell)
+	if !isSupportedShell(shell) {
+		return fmt.Errorf("unsupported shell %s, supported shells are %s", shell, strings.Join(supportedShells(), ", "))
+	}
+	name, bin := c.Name, c.Bin
+	if name == "" {
+		name = ctx.Model.Name
+	}
+	if bin == "" {
+		var err error
+		bin, err = executable()
+		if err != nil {
+			return err
+		}
+	}
+	script, err := completionScript(shell, name, bin)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(ctx.Stdout, script)
+	if err != nil {
+		return err
+	}
+	ctx.Exit(0)
+	return nil
+}
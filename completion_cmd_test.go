@@ -0,0 +1,82 @@
+package kongplete
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompletionCmd(t *testing.T) {
+	var cli struct {
+		Completion CompletionCmd `cmd:""`
+	}
+	newParser := func(t *testing.T, stdout *strings.Builder) *kong.Kong {
+		t.Helper()
+		return kong.Must(&cli, kong.Name("docker"), kong.Writers(stdout, stdout), kong.Exit(func(int) {}))
+	}
+
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell", "nushell", "elvish", "xonsh", "tcsh"} {
+		t.Run(shell, func(t *testing.T) {
+			stdout := &strings.Builder{}
+			_, err := newParser(t, stdout).Parse([]string{"completion", "--bin", "/usr/bin/docker", shell})
+			require.NoError(t, err)
+			want, err := completionScript(shell, "docker", "/usr/bin/docker")
+			require.NoError(t, err)
+			require.Equal(t, want, stdout.String())
+		})
+	}
+
+	t.Run("name", func(t *testing.T) {
+		stdout := &strings.Builder{}
+		_, err := newParser(t, stdout).Parse([]string{"completion", "--name=dkr", "--bin=docker", "bash"})
+		require.NoError(t, err)
+		require.Contains(t, stdout.String(), "docker' __complete ")
+		require.True(t, strings.HasSuffix(stdout.String(), "complete -F _dkr dkr\n"))
+	})
+
+	t.Run("default bin", func(t *testing.T) {
+		stdout := &strings.Builder{}
+		_, err := newParser(t, stdout).Parse([]string{"completion", "bash"})
+		require.NoError(t, err)
+		bin, err := executable()
+		require.NoError(t, err)
+		require.Contains(t, stdout.String(), bin+"' __complete ")
+	})
+
+	t.Run("no shell", func(t *testing.T) {
+		_, err := newParser(t, &strings.Builder{}).Parse([]string{"completion"})
+		require.Error(t, err)
+	})
+
+	t.Run("unsupported shell", func(t *testing.T) {
+		_, err := newParser(t, &strings.Builder{}).Parse([]string{"completion", "csh"})
+		require.EqualError(t, err, "unsupported shell csh, supported shells are bash, elvish, fish, nushell, powershell, tcsh, xonsh, zsh")
+	})
+
+	t.Run("complete shells", func(t *testing.T) {
+		got := runComplete(t, newParser(t, &strings.Builder{}), "docker completion ", nil)
+		require.ElementsMatch(t, []string{"bash", "elvish", "fish", "nushell", "powershell", "tcsh", "xonsh", "zsh"}, got)
+	})
+}
+
+func TestCompletionCmd_globalFlags(t *testing.T) {
+	var cli struct {
+		Name    string
+		Bin     string
+		Verbose bool
+		Output  string
+
+		Completion struct {
+			CompletionCmd `embed:"" prefix:"completion-"`
+		} `cmd:""`
+	}
+	stdout := &strings.Builder{}
+	parser, err := kong.New(&cli, kong.Name("docker"), kong.Writers(stdout, stdout), kong.Exit(func(int) {}))
+	require.NoError(t, err)
+	_, err = parser.Parse([]string{"--name", "x", "--bin", "y", "completion", "--completion-bin", "docker", "bash"})
+	require.NoError(t, err)
+	require.Contains(t, stdout.String(), "docker' __complete ")
+	require.True(t, strings.HasSuffix(stdout.String(), "complete -F _docker docker\n"))
+}
@@ -5,19 +5,47 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
 
 	"github.com/alecthomas/kong"
-	"github.com/riywo/loginshell"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/posener/complete"
 )
 
-// InstallCompletions is a kong command for installing or uninstalling shell completions
+// InstallCompletions is a kong command for installing or uninstalling shell completions. kong rejects flags that
+// collide with the application's own flags, so an application with its own --shell or --dry-run flag can prefix
+// these by embedding InstallCompletions in its command with a prefix tag:
+//
+//	InstallCompletions struct {
+//		kongplete.InstallCompletions `embed:"" prefix:"completion-"`
+//	} `cmd:""`
 type InstallCompletions struct {
-	Uninstall bool
+	Uninstall bool      `help:"Remove installed completions from the shell's config."`
+	Print     bool      `help:"Print the completion script instead of adding it to the shell's config."`
+	DryRun    bool      `help:"Show the changes to the shell's config without making them."`
+	Shell     shellFlag `help:"Shell to install completions for. Detected from the running shell when not set."`
 }
 
 // BeforeApply installs completion into the users shell.
 func (c *InstallCompletions) BeforeApply(ctx *kong.Context) error {
-	err := installCompletionFromContext(ctx)
+	c.traceValues(ctx)
+	shell, err := c.shell()
+	if err != nil {
+		return err
+	}
+	switch {
+	case c.Uninstall:
+		err = uninstallCompletionFromContext(ctx, shell, c.DryRun)
+	case c.Print:
+		err = printCompletionFromContext(ctx, shell)
+	default:
+		err = installCompletionFromContext(ctx, shell, c.DryRun)
+	}
 	if err != nil {
 		return err
 	}
@@ -25,54 +53,776 @@ func (c *InstallCompletions) BeforeApply(ctx *kong.Context) error {
 	return nil
 }
 
+// traceValues sets c's flag fields from the values kong traced.
+func (c *InstallCompletions) traceValues(ctx *kong.Context) {
+	traceValues(ctx, &c.Uninstall, &c.Print, &c.DryRun, &c.Shell)
+}
+
+// shell returns the shell from --shell or detects it when --shell isn't set.
+func (c *InstallCompletions) shell() (string, error) {
+	if c.Shell == "" {
+		return detectShell()
+	}
+	if !isSupportedShell(string(c.Shell)) {
+		return "", fmt.Errorf("unsupported shell %s, supported shells are %s", c.Shell, strings.Join(supportedShells(), ", "))
+	}
+	return string(c.Shell), nil
+}
+
+// traceValues sets the flag and positional argument fields pointed to by fields from the values kong traced. kong
+// calls BeforeApply hooks before it applies values to fields.
+func traceValues(ctx *kong.Context, fields ...interface{}) {
+	set := func(target reflect.Value, value func() reflect.Value) {
+		if !target.CanAddr() {
+			return
+		}
+		addr := target.Addr().Interface()
+		for _, field := range fields {
+			if field == addr {
+				target.Set(value())
+			}
+		}
+	}
+	for _, flag := range ctx.Flags() {
+		flag := flag
+		set(flag.Target, func() reflect.Value { return reflect.ValueOf(ctx.FlagValue(flag)) })
+	}
+	for _, path := range ctx.Path {
+		path := path
+		if path.Positional == nil {
+			continue
+		}
+		set(path.Positional.Target, func() reflect.Value { return ctx.Value(path) })
+	}
+}
+
+// shellFlag is the value of --shell. It predicts the supported shells.
+type shellFlag string
+
+// PredictValue implements ValuePredictor
+func (shellFlag) PredictValue(complete.Args) []string {
+	return supportedShells()
+}
+
+// shellInstall holds the completion script for each shell. ${cmd} is replaced with the command name and ${bin} with
+// the path to its binary quoted for the shell by quoteBin. ${id} is replaced with the command name made into an identifier for shells that name
+// functions after it.
 var shellInstall = map[string]string{
-	"bash": "complete -C ${bin} ${cmd}\n",
-	"zsh": `autoload -U +X bashcompinit && bashcompinit
-complete -C ${bin} ${cmd}
+	"bash": `_${id}() {
+  local c directive cur=${COMP_WORDS[COMP_CWORD]} line=${COMP_LINE:0:COMP_POINT} word strip=
+  local -a lines words
+  COMPREPLY=()
+  # Split the line on whitespace rather than COMP_WORDBREAKS, so "--flag=value" is one word.
+  read -ra words <<< "$line"
+  [[ $line == *[[:space:]] ]] && words+=("")
+  # Candidates are for the whole word, but readline only replaces the part of it in COMP_WORDS, which is split on
+  # COMP_WORDBREAKS. That part is empty when it is only breaks, like the "=" of "--flag=".
+  word=${words[${#words[@]}-1]}
+  [[ -n $cur && -z ${cur//[$COMP_WORDBREAKS]/} ]] && cur=
+  [[ $word == *"$cur" ]] && strip=${word%"$cur"}
+  while IFS= read -r c; do
+    lines+=("$c")
+  done < <(${bin} __complete "${words[@]:1}" 2>/dev/null)
+  (( ${#lines[@]} )) || return
+  # The last line is a directive: [nospace] [nofallback] [files PATTERN | dirs PATTERN]
+  directive=${lines[${#lines[@]}-1]#:}
+  for c in "${lines[@]:0:${#lines[@]}-1}"; do
+    c=${c%%$'\t'*}
+    COMPREPLY+=("${c#"$strip"}")
+  done
+  if [[ $directive == nospace* ]]; then
+    compopt -o nospace 2>/dev/null
+    directive=${directive#nospace}
+    directive=${directive# }
+  fi
+  directive=${directive#nofallback}
+  directive=${directive# }
+  case $directive in
+    'files *') compopt -o filenames 2>/dev/null; COMPREPLY+=($(compgen -f -- "$cur")) ;;
+    'files '*) compopt -o filenames 2>/dev/null; COMPREPLY+=($(compgen -d -- "$cur") $(compgen -f -X "!${directive#files }" -- "$cur")) ;;
+    'dirs '*) compopt -o filenames 2>/dev/null; COMPREPLY+=($(compgen -d -- "$cur")) ;;
+  esac
+}
+complete -F _${id} ${cmd}
+`,
+	"zsh": `#compdef ${cmd}
+# compdef is only defined after compinit, which .zshrc may not run.
+(( $+functions[compdef] )) || { autoload -U compinit && compinit }
+compdef _${cmd} ${cmd}
+
+_${cmd}() {
+  local c group directive ret=1
+  local -a lines parts groups candidates nospace
+  lines=("${(@f)$(${bin} __complete "${(@Q)words[2,CURRENT]}" 2>/dev/null)}")
+  # The last line is a directive: [nospace] [nofallback] [files PATTERN | dirs PATTERN]
+  directive=${lines[-1]#:}
+  lines=("${(@)lines[1,-2]}")
+  if [[ "$directive" == nospace* ]]; then
+    nospace=(-S '')
+    directive=${${directive#nospace}# }
+  fi
+  directive=${${directive#nofallback}# }
+  for c in "${lines[@]}"; do
+    parts=("${(@ps:\t:)c}")
+    group=${parts[3]:-values}
+    (( ${groups[(Ie)$group]} )) || groups+=("$group")
+  done
+  for group in "${groups[@]}"; do
+    candidates=()
+    for c in "${lines[@]}"; do
+      parts=("${(@ps:\t:)c}")
+      [[ "${parts[3]:-values}" == "$group" ]] || continue
+      if [[ -n "${parts[2]}" ]]; then
+        candidates+=("${parts[1]//:/\\:}:${parts[2]}")
+      else
+        candidates+=("${parts[1]//:/\\:}")
+      fi
+    done
+    _describe -t "${${(L)group}// /-}" "$group" candidates "${nospace[@]}" && ret=0
+  done
+  # Paths are completed after the "=" of --flag=value.
+  [[ "$directive" == (files|dirs)\ * ]] && compset -P '--[^=]##='
+  case "$directive" in
+    (files\ *) _files -g "${directive#files }" && ret=0 ;;
+    (dirs\ *) _files -/ && ret=0 ;;
+  esac
+  return ret
+}
+
+# Run the completion function when autoloaded from $fpath, but not when sourced.
+if [[ "${funcstack[1]}" == "_${cmd}" ]]; then
+  _${cmd} "$@"
+fi
 `,
 	"fish": `function __complete_${cmd}
-    set -lx COMP_LINE (commandline -cp)
-    test -z (commandline -ct)
-    and set COMP_LINE "$COMP_LINE "
-    ${bin}
+    set -l args (commandline -opc)
+    set -e args[1]
+    set -l token (commandline -ct)
+    set -l lines (${bin} __complete $args "$token" 2>/dev/null)
+    set -q lines[1]
+    or return
+    # The last line is a directive: [nospace] [nofallback] [files PATTERN | dirs PATTERN]
+    set -l directive (string replace -r -- '^:' '' $lines[-1])
+    set -e lines[-1]
+    set -l candidates
+    for c in $lines
+        set -l parts (string split \t -- $c)
+        set -a candidates "$parts[1]"\t"$parts[2]"
+    end
+    if string match -q -- 'nospace*' $directive
+        # fish adds a space after a lone candidate, so add another one that only differs by a trailing dot.
+        if test (count $candidates) -eq 1
+            set -a candidates (string split -f1 \t -- $candidates[1]).
+        end
+        set directive (string replace -r -- '^nospace ?' '' $directive)
+    end
+    set directive (string replace -r -- '^nofallback ?' '' $directive)
+    printf '%s\n' $candidates
+    # Paths are completed after the "=" of --flag=value, but fish replaces the whole token.
+    set -l prefix (string match -r -- '^--[^=]+=' $token)
+    set -l path (string replace -r -- '^--[^=]+=' '' $token)
+    switch $directive
+        case 'files *'
+            set -l pattern (string replace -- 'files ' '' $directive)
+            for c in (__fish_complete_path $path)
+                set -l name (string split -f1 \t -- $c | string replace -r -- '.*/(?=.)' '')
+                string match -q -- '*/' $name
+                or string match -q -- $pattern $name
+                and printf '%s%s\n' "$prefix" $c
+            end
+        case 'dirs *'
+            for c in (__fish_complete_directories $path)
+                printf '%s%s\n' "$prefix" $c
+            end
+    end
 end
 complete -f -c ${cmd} -a "(__complete_${cmd})"
 `,
+	"powershell": `Register-ArgumentCompleter -Native -CommandName '${cmd}' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $line = $commandAst.Extent.Text
+    $point = $cursorPosition - $commandAst.Extent.StartOffset
+    if ($point -gt $line.Length) {
+        $line = $line.PadRight($point)
+    } else {
+        $line = $line.Substring(0, $point)
+    }
+    # Candidates for --flag=value keep the flag, so list them by their value.
+    $prefix = ''
+    if ($wordToComplete -match '^(--[^=]+=)') {
+        $prefix = $Matches[1]
+    }
+    $words = @(-split $line | Select-Object -Skip 1)
+    if ($line -match '\s$') {
+        $words += ''
+    }
+    # Before PowerShell 7.3, empty arguments to native commands are dropped unless they are quoted.
+    if ($words.Count -and $words[-1] -eq '' -and
+        (-not (Test-Path Variable:PSNativeCommandArgumentPassing) -or $PSNativeCommandArgumentPassing -eq 'Legacy')) {
+        $words[-1] = '""'
+    }
+    # PowerShell can't complete paths by a pattern or only directories, so paths are asked for as candidates.
+    $inlineFiles = $env:KONGPLETE_INLINE_FILES
+    $env:KONGPLETE_INLINE_FILES = '1'
+    $lines = @(& ${bin} __complete @words 2>$null)
+    $env:KONGPLETE_INLINE_FILES = $inlineFiles
+    # The last line is a directive. PowerShell completes paths itself when there are no results, so a result that
+    # leaves the word as it is stops that for nofallback.
+    $results = @($lines | Select-Object -SkipLast 1 | ForEach-Object {
+        $value, $description, $group = $_ -split "` + "`" + `t"
+        $text = $value
+        if ($text -match '[\s''"]') {
+            $text = "'" + $text.Replace("'", "''") + "'"
+        }
+        $listItem = $value
+        if ($prefix -and $value.StartsWith($prefix)) {
+            $listItem = $value.Substring($prefix.Length)
+        }
+        $type = 'ParameterValue'
+        if ($listItem.StartsWith('-')) {
+            $type = 'ParameterName'
+        }
+        if (-not $description) {
+            $description = $listItem
+        }
+        [System.Management.Automation.CompletionResult]::new($text, $listItem, $type, $description)
+    })
+    if (-not $results.Count -and $lines.Count -and $lines[-1] -match '^:(nospace )?nofallback') {
+        $text = $wordToComplete
+        if (-not $text) {
+            $text = ' '
+        }
+        $results = @([System.Management.Automation.CompletionResult]::new($text, $text, 'ParameterValue', $text))
+    }
+    $results
+}
+`,
+	"nushell": `$env.config.completions.external.enable = true
+$env.config.completions.external.completer = do {|previous|
+  {|spans|
+    if ($spans.0 | path basename) != '${cmd}' {
+      if $previous == null { null } else { do $previous $spans }
+    } else {
+      let output = (^${bin} __complete ...($spans | skip 1) | lines)
+      # The last line is a directive. Returning null lets nushell complete paths itself, unless the directive has
+      # nofallback.
+      let directive = ($output | last 1 | str join)
+      let candidates = ($output | drop 1 | each {|c|
+        let parts = ($c | split row "\t")
+        {value: $parts.0, description: ($parts.1? | default '')}
+      })
+      if ($candidates | is-empty) and not ($directive =~ '^:(nospace )?nofallback') { null } else { $candidates }
+    }
+  }
+} $env.config.completions.external.completer
+`,
+	"elvish": `use str
+set edit:completion:arg-completer[${cmd}] = {|@words|
+  var args = $words[1..]
+  # Candidates are "value<TAB>description<TAB>group" and the last line is a directive without tabs. elvish doesn't
+  # read the directive, so paths are asked for as candidates.
+  tmp E:KONGPLETE_INLINE_FILES = 1
+  ${bin} __complete $@args | from-lines | each {|c|
+    var parts = [(str:split "\t" $c)]
+    if (== (count $parts) 3) {
+      if (eq $parts[1] '') {
+        put $parts[0]
+      } else {
+        edit:complex-candidate $parts[0] &display=$parts[0]' -- '$parts[1]
+      }
+    }
+  }
+}
+`,
+	"xonsh": `from xonsh.completers.tools import RichCompletion, contextual_command_completer
+
+
+@contextual_command_completer
+def _kongplete_${id}(context):
+    import os
+    import subprocess
+
+    if not context.args or os.path.basename(context.args[0].value) != '${cmd}':
+        return None
+    words = [arg.value for arg in context.args[1:context.arg_index]] + [context.prefix]
+    # Candidates are "value<TAB>description<TAB>group" and the last line is a directive without tabs. It isn't
+    # read, so paths are asked for as candidates.
+    env = {**${...}.detype(), 'KONGPLETE_INLINE_FILES': '1'}
+    try:
+        output = subprocess.run(
+            [${bin}, '__complete', *words], env=env, capture_output=True, text=True
+        ).stdout
+    except OSError:
+        return None
+    completions = set()
+    for c in output.splitlines():
+        parts = c.split('\t')
+        if len(parts) == 3:
+            completions.add(RichCompletion(parts[0], description=parts[1]))
+    return completions
+
+
+completer add kongplete_${id} _kongplete_${id} start
+`,
+	// tcsh can't split a variable into words while keeping a trailing empty one, so sh splits $COMMAND_LINE and
+	// keeps the values of the candidates. Paths are asked for as candidates since the directive isn't read.
+	"tcsh": "complete ${cmd} 'p@*@`sh -c '\"'\"'" +
+		"b=$1 l=$2; set -f; set -- $l; shift; case $l in *[[:space:]]) set -- \"$@\" \"\";; esac; " +
+		"KONGPLETE_INLINE_FILES=1 \"$b\" __complete \"$@\" 2>/dev/null | while IFS= read -r c; do " +
+		"case $c in *\"\t\"*\"\t\"*) printf \"%s\\n\" \"${c%%\t*}\";; esac; done" +
+		"'\"'\"' sh ${bin} \"$COMMAND_LINE\"`@@'\n",
 }
 
-// installCompletionFromContext writes shell completion for the given command.
-func installCompletionFromContext(ctx *kong.Context) error {
-	shell, err := loginshell.Shell()
+// installCompletionFromContext adds shell completion for the given command to the user's shell config.
+func installCompletionFromContext(ctx *kong.Context, shell string, dryRun bool) error {
+	bin, err := executable()
 	if err != nil {
-		return fmt.Errorf("couldn't determine user's shell: %w", err)
+		return err
 	}
+	return installCompletion(ctx.Stdout, shell, ctx.Model.Name, bin, dryRun)
+}
+
+// printCompletionFromContext writes shell completion for the given command to stdout.
+func printCompletionFromContext(ctx *kong.Context, shell string) error {
+	bin, err := executable()
+	if err != nil {
+		return err
+	}
+	return printCompletion(ctx.Stdout, shell, ctx.Model.Name, bin)
+}
+
+// executable returns the absolute path to the running binary.
+func executable() (string, error) {
 	bin, err := os.Executable()
 	if err != nil {
-		return fmt.Errorf("couldn't find absolute path to ourselves: %w", err)
+		return "", fmt.Errorf("couldn't find absolute path to ourselves: %w", err)
 	}
 	bin, err = filepath.Abs(bin)
 	if err != nil {
-		return fmt.Errorf("couldn't find absolute path to ourselves: %w", err)
+		return "", fmt.Errorf("couldn't find absolute path to ourselves: %w", err)
 	}
-	w := ctx.Stdout
-	cmd := ctx.Model.Name
-	return installCompletion(w, shell, cmd, bin)
+	return bin, nil
 }
 
-// installCompletion writes shell completion for a command.
-func installCompletion(w io.Writer, shell, cmd, bin string) error {
-	script, ok := shellInstall[filepath.Base(shell)]
-	if !ok {
-		return fmt.Errorf("unsupported shell %s", shell)
+// printCompletion writes shell completion for a command. The script is wrapped in begin and end markers so
+// uninstallCompletion can remove it from the shell's config.
+func printCompletion(w io.Writer, shell, cmd, bin string) error {
+	block, err := completionBlock(shell, cmd, bin)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(w, block)
+	return err
+}
+
+// installCompletion adds completion for cmd to the shell's config. Shells that load completions from files get
+// a completion file for cmd. Other shells get a block between markers in their config file, which replaces the
+// block from an earlier install. When dryRun is true, it writes a diff of the changes to w instead of making them.
+func installCompletion(w io.Writer, shell, cmd, bin string, dryRun bool) error {
+	rcFile, completionFile, err := completionPaths(shell, cmd)
+	if err != nil {
+		return err
+	}
+	block, err := completionBlock(shell, cmd, bin)
+	if err != nil {
+		return err
 	}
-	vars := map[string]string{"cmd": cmd, "bin": bin}
-	fragment := os.Expand(script, func(s string) string {
-		v, ok := vars[s]
+	begin, end := blockMarkers(cmd)
+	var change *fileChange
+	if completionFile != "" {
+		change, err = readFileChange(completionFile)
+		if err != nil {
+			return err
+		}
+		// Don't overwrite completion files kongplete didn't write.
+		if change.exists && !strings.HasPrefix(change.before, begin+"\n") {
+			return fmt.Errorf("%s exists and wasn't written by kongplete", completionFile)
+		}
+		change.after = block
+	} else {
+		change, err = readFileChange(rcFile)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		change.after, ok, err = replaceBlock(change.before, begin, end, block)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rcFile, err)
+		}
 		if !ok {
-			return "$" + s
+			change.after = appendBlock(change.before, block)
 		}
-		return v
+	}
+	if change.exists && change.before == change.after {
+		_, err = fmt.Fprintf(w, "completion for %s is already installed in %s\n", cmd, change.path)
+		return err
+	}
+	change.summary = fmt.Sprintf("installed completion for %s in %s", cmd, change.path)
+	return applyFileChanges(w, []*fileChange{change}, dryRun)
+}
+
+// completionBlock returns the completion script for a command wrapped in begin and end markers.
+func completionBlock(shell, cmd, bin string) (string, error) {
+	script, err := completionScript(shell, cmd, bin)
+	if err != nil {
+		return "", err
+	}
+	begin, end := blockMarkers(cmd)
+	return begin + "\n" + script + end + "\n", nil
+}
+
+// supportedShells returns the names of the shells kongplete has completion scripts for.
+func supportedShells() []string {
+	shells := make([]string, 0, len(shellInstall))
+	for shell := range shellInstall {
+		shells = append(shells, shell)
+	}
+	sort.Strings(shells)
+	return shells
+}
+
+// shellName returns the name of shell, which may be a path, as it is keyed in shellInstall.
+func shellName(shell string) string {
+	name := strings.TrimSuffix(filepath.Base(shell), ".exe")
+	switch name {
+	case "pwsh":
+		return "powershell"
+	case "nu":
+		return "nushell"
+	}
+	return name
+}
+
+// isSupportedShell returns true when kongplete has a completion script for shell, which may be a path.
+func isSupportedShell(shell string) bool {
+	_, ok := shellInstall[shellName(shell)]
+	return ok
+}
+
+// procDir is where parentShell looks up our parent process.
+var procDir = "/proc"
+
+// detectShell returns the name of the user's shell. It prefers the shell running us over $SHELL because $SHELL
+// is the login shell, which isn't the shell the user is running when they run fish from a bash login.
+func detectShell() (string, error) {
+	for _, shell := range []string{parentShell(), os.Getenv("SHELL")} {
+		if shell != "" && isSupportedShell(shell) {
+			return shellName(shell), nil
+		}
+	}
+	return "", fmt.Errorf("couldn't detect a supported shell, use --shell with one of %s", strings.Join(supportedShells(), ", "))
+}
+
+// parentShell returns the name of our parent process, which is the user's shell when they run us from one. It
+// returns "" when the name can't be read from /proc.
+func parentShell() string {
+	comm, err := os.ReadFile(filepath.Join(procDir, strconv.Itoa(os.Getppid()), "comm"))
+	if err != nil {
+		return ""
+	}
+	// Login shells are named with a leading "-".
+	return strings.TrimPrefix(strings.TrimSpace(string(comm)), "-")
+}
+
+// completionScript returns the shell completion script for a command.
+func completionScript(shell, cmd, bin string) (string, error) {
+	script, ok := shellInstall[shellName(shell)]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell %s", shell)
+	}
+	return strings.NewReplacer("${cmd}", cmd, "${bin}", quoteBin(shellName(shell), bin), "${id}", identifier(cmd)).Replace(script), nil
+}
+
+// quoteBin quotes the path to a binary as a word of the shell's completion script.
+func quoteBin(shell, bin string) string {
+	switch shell {
+	case "fish":
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(bin) + "'"
+	case "powershell":
+		// PowerShell also takes typographic single quotes as single quotes.
+		return "'" + strings.NewReplacer("'", "''", "\u2018", "\u2018\u2018", "\u2019", "\u2019\u2019",
+			"\u201a", "\u201a\u201a", "\u201b", "\u201b\u201b").Replace(bin) + "'"
+	case "nushell":
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(bin) + `"`
+	case "elvish":
+		return "'" + strings.ReplaceAll(bin, "'", "''") + "'"
+	case "xonsh":
+		return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`, "\n", `\n`, "\r", `\r`).Replace(bin) + "'"
+	case "tcsh":
+		// The word is in the backquoted command of a single-quoted pattern, so its quotes are quoted again.
+		return strings.ReplaceAll(shellQuote(bin), "'", `'"'"'`)
+	default:
+		return shellQuote(bin)
+	}
+}
+
+// identifier replaces the characters of s that aren't allowed in identifiers with underscores.
+func identifier(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// blockMarkers returns the lines that begin and end the completion script for cmd in a shell config file.
+func blockMarkers(cmd string) (begin, end string) {
+	return "# begin kongplete completion for " + cmd, "# end kongplete completion for " + cmd
+}
+
+// powershellProfile is the file name of PowerShell's profile for the current user and host.
+const powershellProfile = "Microsoft.PowerShell_profile.ps1"
+
+// completionPaths returns the shell config file where completion for cmd is added as a block between markers
+// and the file completion for cmd is written to when the shell loads completions from files. Either is empty when
+// it doesn't apply to the shell.
+func completionPaths(shell, cmd string) (rcFile, completionFile string, err error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", fmt.Errorf("couldn't find home directory: %w", err)
+	}
+	switch shellName(shell) {
+	case "bash":
+		return filepath.Join(home, ".bashrc"), "", nil
+	case "zsh":
+		zdotdir := os.Getenv("ZDOTDIR")
+		if zdotdir == "" {
+			zdotdir = home
+		}
+		return filepath.Join(zdotdir, ".zshrc"), "", nil
+	case "fish":
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(home, ".config")
+		}
+		fishDir := filepath.Join(configHome, "fish")
+		return filepath.Join(fishDir, "config.fish"), filepath.Join(fishDir, "completions", cmd+".fish"), nil
+	case "powershell":
+		if runtime.GOOS == "windows" {
+			return filepath.Join(home, "Documents", "PowerShell", powershellProfile), "", nil
+		}
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(home, ".config")
+		}
+		return filepath.Join(configHome, "powershell", powershellProfile), "", nil
+	case "nushell":
+		// Like nushell, only use XDG_CONFIG_HOME when it's set.
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome, err = os.UserConfigDir()
+			if err != nil {
+				return "", "", fmt.Errorf("couldn't find config directory: %w", err)
+			}
+		}
+		return filepath.Join(configHome, "nushell", "config.nu"), "", nil
+	case "elvish":
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		switch {
+		case configHome != "":
+		case runtime.GOOS == "windows":
+			configHome, err = os.UserConfigDir()
+			if err != nil {
+				return "", "", fmt.Errorf("couldn't find config directory: %w", err)
+			}
+		default:
+			configHome = filepath.Join(home, ".config")
+		}
+		return filepath.Join(configHome, "elvish", "rc.elv"), "", nil
+	case "xonsh":
+		return filepath.Join(home, ".xonshrc"), "", nil
+	case "tcsh":
+		return filepath.Join(home, ".tcshrc"), "", nil
+	default:
+		return "", "", fmt.Errorf("unsupported shell %s", shell)
+	}
+}
+
+// uninstallCompletionFromContext removes shell completion for the given command.
+func uninstallCompletionFromContext(ctx *kong.Context, shell string, dryRun bool) error {
+	return uninstallCompletion(ctx.Stdout, shell, ctx.Model.Name, dryRun)
+}
+
+// uninstallCompletion removes completion for cmd from the shell's config file and deletes the shell's completion
+// file for cmd if kongplete wrote it. It reports what it removed to w. When dryRun is true, it writes a diff of
+// the changes to w instead of making them.
+func uninstallCompletion(w io.Writer, shell, cmd string, dryRun bool) error {
+	rcFile, completionFile, err := completionPaths(shell, cmd)
+	if err != nil {
+		return err
+	}
+	begin, end := blockMarkers(cmd)
+	var changes []*fileChange
+	if rcFile != "" {
+		change, err := readFileChange(rcFile)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		change.after, ok, err = removeBlock(change.before, begin, end)
+		if err != nil {
+			return fmt.Errorf("%s: %w", rcFile, err)
+		}
+		if ok {
+			change.summary = fmt.Sprintf("removed completion for %s from %s", cmd, rcFile)
+			changes = append(changes, change)
+		}
+	}
+	if completionFile != "" {
+		change, err := readFileChange(completionFile)
+		if err != nil {
+			return err
+		}
+		// Only delete files kongplete wrote.
+		if strings.HasPrefix(change.before, begin+"\n") {
+			change.remove = true
+			change.summary = "removed " + completionFile
+			changes = append(changes, change)
+		}
+	}
+	if len(changes) == 0 {
+		return fmt.Errorf("no %s completion for %s is installed", shellName(shell), cmd)
+	}
+	return applyFileChanges(w, changes, dryRun)
+}
+
+// removeBlock removes every block of lines from begin to end, inclusive, from content. ok is false when there
+// is no block to remove.
+func removeBlock(content, begin, end string) (updated string, ok bool, err error) {
+	return replaceBlock(content, begin, end, "")
+}
+
+// replaceBlock replaces the first block of lines from begin to end, inclusive, in content with block and
+// removes any other blocks. ok is false when there is no block to replace.
+func replaceBlock(content, begin, end, block string) (updated string, ok bool, err error) {
+	lines := strings.SplitAfter(content, "\n")
+	kept := make([]string, 0, len(lines))
+	inBlock := false
+	for _, line := range lines {
+		trimmed := strings.TrimRight(line, "\r\n")
+		switch {
+		case !inBlock && trimmed == begin:
+			if !ok {
+				kept = append(kept, block)
+			}
+			inBlock = true
+			ok = true
+		case inBlock && trimmed == end:
+			inBlock = false
+		case !inBlock:
+			kept = append(kept, line)
+		}
+	}
+	if inBlock {
+		return content, false, fmt.Errorf("%q has no matching %q", begin, end)
+	}
+	return strings.Join(kept, ""), ok, nil
+}
+
+// appendBlock appends block to content, starting it on a new line.
+func appendBlock(content, block string) string {
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return content + block
+}
+
+// fileChange is a change to a file made by installing or uninstalling completion.
+type fileChange struct {
+	path   string
+	before string
+	after  string
+	// exists is true when the file exists before the change.
+	exists bool
+	// remove is true when the change deletes the file.
+	remove bool
+	// summary describes the change once it is made.
+	summary string
+}
+
+// readFileChange returns a change to the file at path that doesn't change it yet.
+func readFileChange(path string) (*fileChange, error) {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &fileChange{
+		path:   path,
+		before: string(content),
+		after:  string(content),
+		exists: err == nil,
+	}, nil
+}
+
+// apply makes the change.
+func (c *fileChange) apply() error {
+	if c.remove {
+		return os.Remove(c.path)
+	}
+	err := os.MkdirAll(filepath.Dir(c.path), 0o750)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, []byte(c.after), 0o600)
+}
+
+// diff returns a unified diff of the change.
+func (c *fileChange) diff() (string, error) {
+	from, to := c.path, c.path
+	after := c.after
+	if !c.exists {
+		from = os.DevNull
+	}
+	if c.remove {
+		to = os.DevNull
+		after = ""
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        diffLines(c.before),
+		B:        diffLines(after),
+		FromFile: from,
+		ToFile:   to,
+		Context:  3,
 	})
-	_, err := fmt.Fprint(w, fragment)
-	return err
+}
+
+// diffLines splits s into lines for difflib. Every line ends with a newline.
+func diffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+// applyFileChanges makes changes and reports each one to w. When dryRun is true, it writes their diffs to w
+// instead.
+func applyFileChanges(w io.Writer, changes []*fileChange, dryRun bool) error {
+	for _, change := range changes {
+		if dryRun {
+			diff, err := change.diff()
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprint(w, diff)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		err := change.apply()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, change.summary)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -1,31 +1,1178 @@
 package kongplete
 
 import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 
+	"github.com/alecthomas/kong"
 	"github.com/stretchr/testify/require"
 )
 
 func TestInstallCompletion(t *testing.T) {
 	tests := map[string]string{
-		"zsh":  "autoload -U +X bashcompinit && bashcompinit\ncomplete -C /usr/bin/docker docker\n",
-		"bash": "complete -C /usr/bin/docker docker\n",
+		"zsh": `#compdef docker
+# compdef is only defined after compinit, which .zshrc may not run.
+(( $+functions[compdef] )) || { autoload -U compinit && compinit }
+compdef _docker docker
+
+_docker() {
+  local c group directive ret=1
+  local -a lines parts groups candidates nospace
+  lines=("${(@f)$('/usr/bin/docker' __complete "${(@Q)words[2,CURRENT]}" 2>/dev/null)}")
+  # The last line is a directive: [nospace] [nofallback] [files PATTERN | dirs PATTERN]
+  directive=${lines[-1]#:}
+  lines=("${(@)lines[1,-2]}")
+  if [[ "$directive" == nospace* ]]; then
+    nospace=(-S '')
+    directive=${${directive#nospace}# }
+  fi
+  directive=${${directive#nofallback}# }
+  for c in "${lines[@]}"; do
+    parts=("${(@ps:\t:)c}")
+    group=${parts[3]:-values}
+    (( ${groups[(Ie)$group]} )) || groups+=("$group")
+  done
+  for group in "${groups[@]}"; do
+    candidates=()
+    for c in "${lines[@]}"; do
+      parts=("${(@ps:\t:)c}")
+      [[ "${parts[3]:-values}" == "$group" ]] || continue
+      if [[ -n "${parts[2]}" ]]; then
+        candidates+=("${parts[1]//:/\\:}:${parts[2]}")
+      else
+        candidates+=("${parts[1]//:/\\:}")
+      fi
+    done
+    _describe -t "${${(L)group}// /-}" "$group" candidates "${nospace[@]}" && ret=0
+  done
+  # Paths are completed after the "=" of --flag=value.
+  [[ "$directive" == (files|dirs)\ * ]] && compset -P '--[^=]##='
+  case "$directive" in
+    (files\ *) _files -g "${directive#files }" && ret=0 ;;
+    (dirs\ *) _files -/ && ret=0 ;;
+  esac
+  return ret
+}
+
+# Run the completion function when autoloaded from $fpath, but not when sourced.
+if [[ "${funcstack[1]}" == "_docker" ]]; then
+  _docker "$@"
+fi
+`,
+		"bash": `_docker() {
+  local c directive cur=${COMP_WORDS[COMP_CWORD]} line=${COMP_LINE:0:COMP_POINT} word strip=
+  local -a lines words
+  COMPREPLY=()
+  # Split the line on whitespace rather than COMP_WORDBREAKS, so "--flag=value" is one word.
+  read -ra words <<< "$line"
+  [[ $line == *[[:space:]] ]] && words+=("")
+  # Candidates are for the whole word, but readline only replaces the part of it in COMP_WORDS, which is split on
+  # COMP_WORDBREAKS. That part is empty when it is only breaks, like the "=" of "--flag=".
+  word=${words[${#words[@]}-1]}
+  [[ -n $cur && -z ${cur//[$COMP_WORDBREAKS]/} ]] && cur=
+  [[ $word == *"$cur" ]] && strip=${word%"$cur"}
+  while IFS= read -r c; do
+    lines+=("$c")
+  done < <('/usr/bin/docker' __complete "${words[@]:1}" 2>/dev/null)
+  (( ${#lines[@]} )) || return
+  # The last line is a directive: [nospace] [nofallback] [files PATTERN | dirs PATTERN]
+  directive=${lines[${#lines[@]}-1]#:}
+  for c in "${lines[@]:0:${#lines[@]}-1}"; do
+    c=${c%%$'\t'*}
+    COMPREPLY+=("${c#"$strip"}")
+  done
+  if [[ $directive == nospace* ]]; then
+    compopt -o nospace 2>/dev/null
+    directive=${directive#nospace}
+    directive=${directive# }
+  fi
+  directive=${directive#nofallback}
+  directive=${directive# }
+  case $directive in
+    'files *') compopt -o filenames 2>/dev/null; COMPREPLY+=($(compgen -f -- "$cur")) ;;
+    'files '*) compopt -o filenames 2>/dev/null; COMPREPLY+=($(compgen -d -- "$cur") $(compgen -f -X "!${directive#files }" -- "$cur")) ;;
+    'dirs '*) compopt -o filenames 2>/dev/null; COMPREPLY+=($(compgen -d -- "$cur")) ;;
+  esac
+}
+complete -F _docker docker
+`,
 		"fish": `function __complete_docker
-    set -lx COMP_LINE (commandline -cp)
-    test -z (commandline -ct)
-    and set COMP_LINE "$COMP_LINE "
-    /usr/bin/docker
+    set -l args (commandline -opc)
+    set -e args[1]
+    set -l token (commandline -ct)
+    set -l lines ('/usr/bin/docker' __complete $args "$token" 2>/dev/null)
+    set -q lines[1]
+    or return
+    # The last line is a directive: [nospace] [nofallback] [files PATTERN | dirs PATTERN]
+    set -l directive (string replace -r -- '^:' '' $lines[-1])
+    set -e lines[-1]
+    set -l candidates
+    for c in $lines
+        set -l parts (string split \t -- $c)
+        set -a candidates "$parts[1]"\t"$parts[2]"
+    end
+    if string match -q -- 'nospace*' $directive
+        # fish adds a space after a lone candidate, so add another one that only differs by a trailing dot.
+        if test (count $candidates) -eq 1
+            set -a candidates (string split -f1 \t -- $candidates[1]).
+        end
+        set directive (string replace -r -- '^nospace ?' '' $directive)
+    end
+    set directive (string replace -r -- '^nofallback ?' '' $directive)
+    printf '%s\n' $candidates
+    # Paths are completed after the "=" of --flag=value, but fish replaces the whole token.
+    set -l prefix (string match -r -- '^--[^=]+=' $token)
+    set -l path (string replace -r -- '^--[^=]+=' '' $token)
+    switch $directive
+        case 'files *'
+            set -l pattern (string replace -- 'files ' '' $directive)
+            for c in (__fish_complete_path $path)
+                set -l name (string split -f1 \t -- $c | string replace -r -- '.*/(?=.)' '')
+                string match -q -- '*/' $name
+                or string match -q -- $pattern $name
+                and printf '%s%s\n' "$prefix" $c
+            end
+        case 'dirs *'
+            for c in (__fish_complete_directories $path)
+                printf '%s%s\n' "$prefix" $c
+            end
+    end
 end
 complete -f -c docker -a "(__complete_docker)"
+`,
+		"nushell": `$env.config.completions.external.enable = true
+$env.config.completions.external.completer = do {|previous|
+  {|spans|
+    if ($spans.0 | path basename) != 'docker' {
+      if $previous == null { null } else { do $previous $spans }
+    } else {
+      let output = (^"/usr/bin/docker" __complete ...($spans | skip 1) | lines)
+      # The last line is a directive. Returning null lets nushell complete paths itself, unless the directive has
+      # nofallback.
+      let directive = ($output | last 1 | str join)
+      let candidates = ($output | drop 1 | each {|c|
+        let parts = ($c | split row "\t")
+        {value: $parts.0, description: ($parts.1? | default '')}
+      })
+      if ($candidates | is-empty) and not ($directive =~ '^:(nospace )?nofallback') { null } else { $candidates }
+    }
+  }
+} $env.config.completions.external.completer
+`,
+		"elvish": `use str
+set edit:completion:arg-completer[docker] = {|@words|
+  var args = $words[1..]
+  # Candidates are "value<TAB>description<TAB>group" and the last line is a directive without tabs. elvish doesn't
+  # read the directive, so paths are asked for as candidates.
+  tmp E:KONGPLETE_INLINE_FILES = 1
+  '/usr/bin/docker' __complete $@args | from-lines | each {|c|
+    var parts = [(str:split "\t" $c)]
+    if (== (count $parts) 3) {
+      if (eq $parts[1] '') {
+        put $parts[0]
+      } else {
+        edit:complex-candidate $parts[0] &display=$parts[0]' -- '$parts[1]
+      }
+    }
+  }
+}
+`,
+		"xonsh": `from xonsh.completers.tools import RichCompletion, contextual_command_completer
+
+
+@contextual_command_completer
+def _kongplete_docker(context):
+    import os
+    import subprocess
+
+    if not context.args or os.path.basename(context.args[0].value) != 'docker':
+        return None
+    words = [arg.value for arg in context.args[1:context.arg_index]] + [context.prefix]
+    # Candidates are "value<TAB>description<TAB>group" and the last line is a directive without tabs. It isn't
+    # read, so paths are asked for as candidates.
+    env = {**${...}.detype(), 'KONGPLETE_INLINE_FILES': '1'}
+    try:
+        output = subprocess.run(
+            ['/usr/bin/docker', '__complete', *words], env=env, capture_output=True, text=True
+        ).stdout
+    except OSError:
+        return None
+    completions = set()
+    for c in output.splitlines():
+        parts = c.split('\t')
+        if len(parts) == 3:
+            completions.add(RichCompletion(parts[0], description=parts[1]))
+    return completions
+
+
+completer add kongplete_docker _kongplete_docker start
+`,
+		"tcsh": "complete docker 'p@*@`sh -c '\"'\"'b=$1 l=$2; set -f; set -- $l; shift; case $l in *[[:space:]]) set -- \"$@\" \"\";; esac; KONGPLETE_INLINE_FILES=1 \"$b\" __complete \"$@\" 2>/dev/null | while IFS= read -r c; do case $c in *\"\t\"*\"\t\"*) printf \"%s\\n\" \"${c%%\t*}\";; esac; done'\"'\"' sh '\"'\"'/usr/bin/docker'\"'\"' \"$COMMAND_LINE\"`@@'\n",
+		"powershell": `Register-ArgumentCompleter -Native -CommandName 'docker' -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $line = $commandAst.Extent.Text
+    $point = $cursorPosition - $commandAst.Extent.StartOffset
+    if ($point -gt $line.Length) {
+        $line = $line.PadRight($point)
+    } else {
+        $line = $line.Substring(0, $point)
+    }
+    # Candidates for --flag=value keep the flag, so list them by their value.
+    $prefix = ''
+    if ($wordToComplete -match '^(--[^=]+=)') {
+        $prefix = $Matches[1]
+    }
+    $words = @(-split $line | Select-Object -Skip 1)
+    if ($line -match '\s$') {
+        $words += ''
+    }
+    # Before PowerShell 7.3, empty arguments to native commands are dropped unless they are quoted.
+    if ($words.Count -and $words[-1] -eq '' -and
+        (-not (Test-Path Variable:PSNativeCommandArgumentPassing) -or $PSNativeCommandArgumentPassing -eq 'Legacy')) {
+        $words[-1] = '""'
+    }
+    # PowerShell can't complete paths by a pattern or only directories, so paths are asked for as candidates.
+    $inlineFiles = $env:KONGPLETE_INLINE_FILES
+    $env:KONGPLETE_INLINE_FILES = '1'
+    $lines = @(& '/usr/bin/docker' __complete @words 2>$null)
+    $env:KONGPLETE_INLINE_FILES = $inlineFiles
+    # The last line is a directive. PowerShell completes paths itself when there are no results, so a result that
+    # leaves the word as it is stops that for nofallback.
+    $results = @($lines | Select-Object -SkipLast 1 | ForEach-Object {
+        $value, $description, $group = $_ -split "` + "`" + `t"
+        $text = $value
+        if ($text -match '[\s''"]') {
+            $text = "'" + $text.Replace("'", "''") + "'"
+        }
+        $listItem = $value
+        if ($prefix -and $value.StartsWith($prefix)) {
+            $listItem = $value.Substring($prefix.Length)
+        }
+        $type = 'ParameterValue'
+        if ($listItem.StartsWith('-')) {
+            $type = 'ParameterName'
+        }
+        if (-not $description) {
+            $description = $listItem
+        }
+        [System.Management.Automation.CompletionResult]::new($text, $listItem, $type, $description)
+    })
+    if (-not $results.Count -and $lines.Count -and $lines[-1] -match '^:(nospace )?nofallback') {
+        $text = $wordToComplete
+        if (-not $text) {
+            $text = ' '
+        }
+        $results = @([System.Management.Automation.CompletionResult]::new($text, $text, 'ParameterValue', $text))
+    }
+    $results
+}
 `,
 	}
 	for shell, fragment := range tests {
 		t.Run(shell, func(t *testing.T) {
 			w := &strings.Builder{}
-			err := installCompletion(w, shell, "docker", "/usr/bin/docker")
+			err := printCompletion(w, shell, "docker", "/usr/bin/docker")
+			require.NoError(t, err)
+			want := "# begin kongplete completion for docker\n" + fragment + "# end kongplete completion for docker\n"
+			require.Equal(t, want, w.String())
+		})
+	}
+
+	t.Run("pwsh", func(t *testing.T) {
+		w := &strings.Builder{}
+		err := printCompletion(w, "/usr/bin/pwsh", "docker", "/usr/bin/docker")
+		require.NoError(t, err)
+		require.Contains(t, w.String(), "Register-ArgumentCompleter -Native -CommandName 'docker'")
+	})
+
+	t.Run("xonsh identifier", func(t *testing.T) {
+		w := &strings.Builder{}
+		err := printCompletion(w, "xonsh", "docker-compose", "/usr/bin/docker-compose")
+		require.NoError(t, err)
+		require.Contains(t, w.String(), "def _kongplete_docker_compose(context):\n")
+		require.Contains(t, w.String(), "!= 'docker-compose':\n")
+	})
+
+	t.Run("unsupported shell", func(t *testing.T) {
+		err := printCompletion(&strings.Builder{}, "/bin/csh", "docker", "/usr/bin/docker")
+		require.EqualError(t, err, "unsupported shell /bin/csh")
+	})
+}
+
+func TestCompletionScript_quotedBin(t *testing.T) {
+	bin := `/home/o'brien/bin/app`
+	tests := map[string]string{
+		"bash":       `done < <('/home/o'\''brien/bin/app' __complete "${words[@]:1}" 2>/dev/null)`,
+		"zsh":        `lines=("${(@f)$('/home/o'\''brien/bin/app' __complete "${(@Q)words[2,CURRENT]}" 2>/dev/null)}")`,
+		"fish":       `set -l lines ('/home/o\'brien/bin/app' __complete $args "$token" 2>/dev/null)`,
+		"powershell": `$lines = @(& '/home/o''brien/bin/app' __complete @words 2>$null)`,
+		"nushell":    `let output = (^"/home/o'brien/bin/app" __complete ...($spans | skip 1) | lines)`,
+		"elvish":     `'/home/o''brien/bin/app' __complete $@args | from-lines | each {|c|`,
+		"xonsh":      `['/home/o\'brien/bin/app', '__complete', *words], env=env, capture_output=True, text=True`,
+		"tcsh":       `sh '"'"'/home/o'"'"'\'"'"''"'"'brien/bin/app'"'"' "$COMMAND_LINE"` + "`@@'",
+	}
+	for shell, want := range tests {
+		t.Run(shell, func(t *testing.T) {
+			script, err := completionScript(shell, "app", bin)
+			require.NoError(t, err)
+			require.Contains(t, script, want)
+		})
+	}
+}
+
+func TestCompletionScript_bash(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is required")
+	}
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.txt"), "")
+	writeFile(t, filepath.Join(dir, "b.go"), "")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700))
+	// The space and quote in the binary's path check that the script quotes it.
+	binDir := filepath.Join(t.TempDir(), "o'brien tools")
+	require.NoError(t, os.Mkdir(binDir, 0o700))
+	bin := filepath.Join(binDir, "docker")
+	output := filepath.Join(binDir, "output")
+	args := filepath.Join(binDir, "args")
+	writeFile(t, bin, "#!/bin/sh\nprintf '%s\\n' \"$@\" > "+shellQuote(args)+"\ncat "+shellQuote(output)+"\n")
+	require.NoError(t, os.Chmod(bin, 0o700))
+	script, err := completionScript("bash", "docker", bin)
+	require.NoError(t, err)
+	scriptFile := filepath.Join(dir, "docker.bash")
+	writeFile(t, scriptFile, script)
+
+	for _, td := range []struct {
+		name   string
+		output string
+		cur    string
+		// words are the COMP_WORDS bash splits cur into on COMP_WORDBREAKS. They are just cur when not set.
+		words []string
+		want  string
+	}{
+		{
+			name:   "candidates",
+			output: "get\tGet things.\tCommands\nput\t\tCommands\n:\n",
+			want:   "get\nput\n",
+		},
+		{
+			name:   "nospace",
+			output: "a/\t\t\n:nospace\n",
+			want:   "compopt -o nospace\na/\n",
+		},
+		{
+			name:   "files",
+			output: ":nofallback files *.go\n",
+			cur:    dir + "/",
+			want:   "compopt -o filenames\n" + dir + "/sub\n" + dir + "/b.go\n",
+		},
+		{
+			name:   "dirs",
+			output: "x\t\t\n:nospace dirs *\n",
+			cur:    dir + "/",
+			want:   "compopt -o nospace\ncompopt -o filenames\nx\n" + dir + "/sub\n",
+		},
+		{
+			name:   "nofallback",
+			output: ":nofallback\n",
+		},
+		{
+			name:   "flag value",
+			output: "--label=env=prod\t\t\n--label=env=dev\t\t\n:\n",
+			cur:    "--label=env=",
+			words:  []string{"--label", "=", "env", "="},
+			want:   "prod\ndev\n",
+		},
+		{
+			name:   "colon",
+			output: "repo:latest\t\t\nrepo:v1\t\t\n:\n",
+			cur:    "repo:la",
+			words:  []string{"repo", ":", "la"},
+			want:   "latest\nv1\n",
+		},
+		{
+			name:   "map separator",
+			output: "--set=a=1;b=2\t\t\n:\n",
+			cur:    "--set=a=1;b",
+			words:  []string{"--set", "=", "a", "=", "1", ";", "b"},
+			want:   "b=2\n",
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			writeFile(t, output, td.output)
+			words := td.words
+			if words == nil {
+				words = []string{td.cur}
+			}
+			cmd := exec.Command("bash", append([]string{"-c", `source "$1"
+compopt() { echo "compopt $*"; }
+COMP_LINE="docker $2" COMP_POINT=${#COMP_LINE} COMP_WORDS=(docker "${@:3}") COMP_CWORD=$(($# - 2))
+_docker
+(( ${#COMPREPLY[@]} )) && printf '%s\n' "${COMPREPLY[@]}"
+true`, "bash", scriptFile, td.cur}, words...)...)
+			cmd.Stderr = os.Stderr
+			out, err := cmd.Output()
+			require.NoError(t, err)
+			require.Equal(t, td.want, string(out))
+			require.Equal(t, "__complete\n"+td.cur+"\n", readFile(t, args))
+		})
+	}
+}
+
+func TestCompletionScript_zsh(t *testing.T) {
+	if _, err := exec.LookPath("zsh"); err != nil {
+		t.Skip("zsh is required")
+	}
+	home := setHome(t)
+	script, err := completionScript("zsh", "docker", "/usr/bin/docker")
+	require.NoError(t, err)
+	scriptFile := filepath.Join(home, "docker.zsh")
+	writeFile(t, scriptFile, script)
+	// Sourcing the script from a .zshrc that never runs compinit still registers the completion.
+	cmd := exec.Command("zsh", "-f", "-c", `source "$1" && print -r -- $_comps[docker]`, "zsh", scriptFile)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	require.NoError(t, err, stderr.String())
+	require.Equal(t, "_docker\n", string(out))
+	require.Empty(t, stderr.String())
+
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "docker")
+	output := filepath.Join(dir, "output")
+	args := filepath.Join(dir, "args")
+	writeFile(t, bin, "#!/bin/sh\nprintf '%s\\n' \"$@\" > "+shellQuote(args)+"\ncat "+shellQuote(output)+"\n")
+	require.NoError(t, os.Chmod(bin, 0o700))
+	script, err = completionScript("zsh", "docker", bin)
+	require.NoError(t, err)
+	scriptFile = filepath.Join(dir, "_docker")
+	writeFile(t, scriptFile, script)
+
+	for _, td := range []struct {
+		name   string
+		output string
+		// words are the words on the command line after "docker", as zsh has them before removing quotes.
+		words []string
+		want  string
+		args  string
+	}{
+		{
+			name:   "candidates",
+			output: "get\tGet things.\tCommands\nput\t\tCommands\nlist\t\t\n:\n",
+			words:  []string{""},
+			want:   "_describe -t commands Commands get:Get things. put\n_describe -t values values list\nret 0\n",
+			args:   "__complete\n\n",
+		},
+		{
+			name:   "colon",
+			output: "repo:latest\t\t\n:\n",
+			words:  []string{"repo:"},
+			want:   "_describe -t values values repo\\:latest\nret 0\n",
+			args:   "__complete\nrepo:\n",
+		},
+		{
+			name:   "nospace",
+			output: "--label=\t\t\n:nospace\n",
+			words:  []string{"--l"},
+			want:   "_describe -t values values --label= -S \nret 0\n",
+			args:   "__complete\n--l\n",
+		},
+		{
+			name:   "files",
+			output: ":nofallback files *.go\n",
+			words:  []string{"-v", "sub/"},
+			want:   "compset -P --[^=]##=\n_files -g *.go\nret 0\n",
+			args:   "__complete\n-v\nsub/\n",
+		},
+		{
+			name:   "flag files",
+			output: ":files *\n",
+			words:  []string{"--config=sub/"},
+			want:   "compset -P --[^=]##=\n_files -g *\nret 0\n",
+			args:   "__complete\n--config=sub/\n",
+		},
+		{
+			name:   "dirs",
+			output: "x\t\t\n:nospace dirs *\n",
+			words:  []string{""},
+			want:   "_describe -t values values x -S \ncompset -P --[^=]##=\n_files -/\nret 0\n",
+			args:   "__complete\n\n",
+		},
+		{
+			name:   "nofallback",
+			output: ":nofallback\n",
+			words:  []string{""},
+			want:   "ret 1\n",
+			args:   "__complete\n\n",
+		},
+		{
+			name:   "quoted word",
+			output: ":\n",
+			words:  []string{"'a b'", "c\\ d"},
+			want:   "ret 1\n",
+			args:   "__complete\na b\nc d\n",
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			writeFile(t, output, td.output)
+			// The completion system's functions only work in a completion widget, so they are replaced by ones
+			// that print how they were called.
+			cmd := exec.Command("zsh", append([]string{"-f", "-c", `compdef() { :; }
+source "$1"
+_describe() { print -r -- _describe "${@[1,3]}" "${(@P)4}" "${@[5,-1]}"; }
+compset() { print -r -- compset "$@"; }
+_files() { print -r -- _files "$@"; }
+words=(docker "${@[2,-1]}") CURRENT=$#
+_docker
+print -r -- ret $?`, "zsh", scriptFile}, td.words...)...)
+			cmd.Stderr = os.Stderr
+			out, err := cmd.Output()
+			require.NoError(t, err)
+			require.Equal(t, td.want, string(out))
+			require.Equal(t, td.args, readFile(t, args))
+		})
+	}
+}
+
+func TestCompletionScript_fish(t *testing.T) {
+	if _, err := exec.LookPath("fish"); err != nil {
+		t.Skip("fish is required")
+	}
+	setHome(t)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.txt"), "")
+	writeFile(t, filepath.Join(dir, "b.go"), "")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700))
+	binDir := t.TempDir()
+	bin := filepath.Join(binDir, "docker")
+	output := filepath.Join(binDir, "output")
+	args := filepath.Join(binDir, "args")
+	writeFile(t, bin, "#!/bin/sh\nprintf '%s\\n' \"$@\" > "+shellQuote(args)+"\ncat "+shellQuote(output)+"\n")
+	require.NoError(t, os.Chmod(bin, 0o700))
+	script, err := completionScript("fish", "docker", bin)
+	require.NoError(t, err)
+	scriptFile := filepath.Join(dir, "docker.fish")
+	writeFile(t, scriptFile, script)
+
+	for _, td := range []struct {
+		name   string
+		output string
+		line   string
+		want   []string
+		args   string
+	}{
+		{
+			name:   "candidates",
+			output: "get\tGet things.\tCommands\nput\t\tCommands\n:\n",
+			line:   "docker ",
+			want:   []string{"get", "put"},
+			args:   "__complete\n\n",
+		},
+		{
+			// fish adds a space after a lone candidate unless there is another one that only adds a dot.
+			name:   "nospace",
+			output: "--label=\t\t\n:nospace\n",
+			line:   "docker --l",
+			want:   []string{"--label=", "--label=."},
+			args:   "__complete\n--l\n",
+		},
+		{
+			name:   "files",
+			output: ":nofallback files *.go\n",
+			line:   "docker -v " + dir + "/",
+			want:   []string{dir + "/b.go", dir + "/sub/"},
+			args:   "__complete\n-v\n" + dir + "/\n",
+		},
+		{
+			name:   "flag files",
+			output: ":files *.go\n",
+			line:   "docker --config=" + dir + "/",
+			want:   []string{"--config=" + dir + "/b.go", "--config=" + dir + "/sub/"},
+			args:   "__complete\n--config=" + dir + "/\n",
+		},
+		{
+			name:   "dirs",
+			output: "x\t\t\n:nospace dirs *\n",
+			line:   "docker " + dir + "/",
+			want:   []string{dir + "/sub/"},
+			args:   "__complete\n" + dir + "/\n",
+		},
+		{
+			name:   "nofallback",
+			output: ":nofallback\n",
+			line:   "docker ",
+			args:   "__complete\n\n",
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			writeFile(t, output, td.output)
+			cmd := exec.Command("fish", "-c", `source $SCRIPT_FILE; and complete -C $LINE`)
+			cmd.Env = append(os.Environ(), "SCRIPT_FILE="+scriptFile, "LINE="+td.line)
+			cmd.Stderr = os.Stderr
+			out, err := cmd.Output()
+			require.NoError(t, err)
+			// Descriptions of paths differ between fish versions, so only the completions are compared.
+			var got []string
+			for _, line := range parseOutput(string(out)) {
+				got = append(got, strings.Split(line, "\t")[0])
+			}
+			require.ElementsMatch(t, td.want, got)
+			require.Equal(t, td.args, readFile(t, args))
+		})
+	}
+}
+
+func TestCompletionScript_powershell(t *testing.T) {
+	if _, err := exec.LookPath("pwsh"); err != nil {
+		t.Skip("pwsh is required")
+	}
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "docker")
+	output := filepath.Join(dir, "output")
+	args := filepath.Join(dir, "args")
+	writeFile(t, bin, "#!/bin/sh\nprintf '%s\\n' \"$KONGPLETE_INLINE_FILES\" \"$@\" > "+shellQuote(args)+"\ncat "+shellQuote(output)+"\n")
+	require.NoError(t, os.Chmod(bin, 0o700))
+	script, err := completionScript("powershell", "docker", bin)
+	require.NoError(t, err)
+	scriptFile := filepath.Join(dir, "docker.ps1")
+	writeFile(t, scriptFile, script)
+
+	for _, td := range []struct {
+		name   string
+		output string
+		input  string
+		want   string
+		args   string
+	}{
+		{
+			name:   "candidates",
+			output: "get\tGet things.\tCommands\nput\t\tCommands\n:\n",
+			input:  "docker ",
+			want:   "get|get|Get things.\nput|put|put\n",
+			args:   "1\n__complete\n\n",
+		},
+		{
+			name:   "flag names",
+			output: "--format\tOutput format.\tFlags\n:\n",
+			input:  "docker --f",
+			want:   "--format|--format|Output format.\n",
+			args:   "1\n__complete\n--f\n",
+		},
+		{
+			name:   "flag value",
+			output: "--label=env=prod\t\t\n--label=env=dev\tDevelopment.\t\n:\n",
+			input:  "docker --label=env=",
+			want:   "--label=env=prod|env=prod|env=prod\n--label=env=dev|env=dev|Development.\n",
+			args:   "1\n__complete\n--label=env=\n",
+		},
+		{
+			name:   "quoted",
+			output: "a b\t\t\n:\n",
+			input:  "docker a",
+			want:   "'a b'|a b|a b\n",
+			args:   "1\n__complete\na\n",
+		},
+		{
+			name:   "nofallback",
+			output: ":nofallback\n",
+			input:  "docker ",
+			want:   " | | \n",
+			args:   "1\n__complete\n\n",
+		},
+		{
+			name:   "nofallback word",
+			output: ":nospace nofallback\n",
+			input:  "docker x",
+			want:   "x|x|x\n",
+			args:   "1\n__complete\nx\n",
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			writeFile(t, output, td.output)
+			cmd := exec.Command("pwsh", "-NoProfile", "-NonInteractive", "-Command", `. $env:SCRIPT_FILE
+$result = TabExpansion2 -inputScript $env:INPUT -cursorColumn $env:INPUT.Length
+$result.CompletionMatches | ForEach-Object { '{0}|{1}|{2}' -f $_.CompletionText, $_.ListItemText, $_.ToolTip }`)
+			cmd.Env = append(os.Environ(),
+				"SCRIPT_FILE="+scriptFile,
+				"INPUT="+td.input,
+				"PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"),
+			)
+			cmd.Stderr = os.Stderr
+			out, err := cmd.Output()
+			require.NoError(t, err)
+			require.Equal(t, td.want, strings.ReplaceAll(string(out), "\r\n", "\n"))
+			require.Equal(t, td.args, readFile(t, args))
+		})
+	}
+}
+
+// TestCompletionScript_paths runs a path flag through the scripts for shells that don't read the directive, so
+// they get paths as candidates.
+func TestCompletionScript_paths(t *testing.T) {
+	dir := t.TempDir()
+	bin := writeHelperBin(t, dir, filepath.Join(dir, "calls"))
+	files := filepath.Join(dir, "files")
+	writeFile(t, filepath.Join(files, "a.txt"), "")
+	require.NoError(t, os.Mkdir(filepath.Join(files, "sub"), 0o700))
+	line := "app --config " + files + "/"
+	want := []string{files + "/", filepath.Join(files, "a.txt"), filepath.Join(files, "sub") + "/"}
+
+	t.Run("tcsh", func(t *testing.T) {
+		script, err := completionScript("tcsh", "app", bin)
+		require.NoError(t, err)
+		// The completions come from the sh program, which is run with the binary and $COMMAND_LINE.
+		_, program, ok := strings.Cut(script, `sh -c '"'"'`)
+		require.True(t, ok)
+		program, _, ok = strings.Cut(program, `'"'"' sh `)
+		require.True(t, ok)
+		out, err := exec.Command("sh", "-c", program, "sh", bin, line).Output()
+		require.NoError(t, err)
+		require.ElementsMatch(t, want, parseOutput(string(out)))
+	})
+
+	t.Run("elvish", func(t *testing.T) {
+		if _, err := exec.LookPath("elvish"); err != nil {
+			t.Skip("elvish is required")
+		}
+		script, err := completionScript("elvish", "app", bin)
+		require.NoError(t, err)
+		// The edit module is only loaded in interactive shells, so the completer is called directly.
+		script = strings.Replace(script, "set edit:completion:arg-completer[app] =", "var complete =", 1)
+		script += "$complete app --config " + shellQuote(files+"/") + " | each {|c| echo $c }\n"
+		out, err := exec.Command("elvish", "-norc", "-c", script).Output()
+		require.NoError(t, err)
+		require.ElementsMatch(t, want, parseOutput(string(out)))
+	})
+
+	t.Run("xonsh", func(t *testing.T) {
+		if _, err := exec.LookPath("xonsh"); err != nil {
+			t.Skip("xonsh is required")
+		}
+		script, err := completionScript("xonsh", "app", bin)
+		require.NoError(t, err)
+		script += `
+from xonsh.parsers.completion_context import CommandArg, CommandContext, CompletionContext
+command = CommandContext(args=(CommandArg('app'), CommandArg('--config')), arg_index=2, prefix=$FILES + '/')
+for c in _kongplete_app(CompletionContext(command=command)):
+    print(c)
+`
+		cmd := exec.Command("xonsh", "--no-rc", "-c", script)
+		cmd.Env = append(os.Environ(), "FILES="+files)
+		out, err := cmd.Output()
+		require.NoError(t, err)
+		require.ElementsMatch(t, want, parseOutput(string(out)))
+	})
+}
+
+func TestInstallCompletion_write(t *testing.T) {
+	block, err := completionBlock("bash", "docker", "/usr/bin/docker")
+	require.NoError(t, err)
+
+	t.Run("bash", func(t *testing.T) {
+		home := setHome(t)
+		bashrc := filepath.Join(home, ".bashrc")
+		writeFile(t, bashrc, "export FOO=bar")
+		w := &strings.Builder{}
+		err := installCompletion(w, "/bin/bash", "docker", "/usr/bin/docker", false)
+		require.NoError(t, err)
+		require.Equal(t, "installed completion for docker in "+bashrc+"\n", w.String())
+		require.Equal(t, "export FOO=bar\n"+block, readFile(t, bashrc))
+	})
+
+	t.Run("bash without bashrc", func(t *testing.T) {
+		home := setHome(t)
+		err := installCompletion(&strings.Builder{}, "bash", "docker", "/usr/bin/docker", false)
+		require.NoError(t, err)
+		require.Equal(t, block, readFile(t, filepath.Join(home, ".bashrc")))
+	})
+
+	t.Run("replaces earlier install", func(t *testing.T) {
+		home := setHome(t)
+		bashrc := filepath.Join(home, ".bashrc")
+		old := "# begin kongplete completion for docker\ncomplete -C /opt/docker docker\n# end kongplete completion for docker\n"
+		writeFile(t, bashrc, "export FOO=bar\n"+old+"alias ll='ls -l'\n")
+		err := installCompletion(&strings.Builder{}, "bash", "docker", "/usr/bin/docker", false)
+		require.NoError(t, err)
+		require.Equal(t, "export FOO=bar\n"+block+"alias ll='ls -l'\n", readFile(t, bashrc))
+	})
+
+	t.Run("already installed", func(t *testing.T) {
+		home := setHome(t)
+		bashrc := filepath.Join(home, ".bashrc")
+		writeFile(t, bashrc, block)
+		w := &strings.Builder{}
+		err := installCompletion(w, "bash", "docker", "/usr/bin/docker", false)
+		require.NoError(t, err)
+		require.Equal(t, "completion for docker is already installed in "+bashrc+"\n", w.String())
+		require.Equal(t, block, readFile(t, bashrc))
+	})
+
+	t.Run("zsh with ZDOTDIR", func(t *testing.T) {
+		setHome(t)
+		zdotdir := t.TempDir()
+		t.Setenv("ZDOTDIR", zdotdir)
+		err := installCompletion(&strings.Builder{}, "zsh", "docker", "/usr/bin/docker", false)
+		require.NoError(t, err)
+		require.Contains(t, readFile(t, filepath.Join(zdotdir, ".zshrc")), "compdef _docker docker\n")
+	})
+
+	t.Run("fish with XDG_CONFIG_HOME", func(t *testing.T) {
+		setHome(t)
+		configHome := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", configHome)
+		completionFile := filepath.Join(configHome, "fish", "completions", "docker.fish")
+		w := &strings.Builder{}
+		err := installCompletion(w, "fish", "docker", "/usr/bin/docker", false)
+		require.NoError(t, err)
+		require.Equal(t, "installed completion for docker in "+completionFile+"\n", w.String())
+		require.Contains(t, readFile(t, completionFile), "complete -f -c docker -a \"(__complete_docker)\"\n")
+		require.NoFileExists(t, filepath.Join(configHome, "fish", "config.fish"))
+	})
+
+	t.Run("powershell", func(t *testing.T) {
+		home := setHome(t)
+		profile := filepath.Join(home, ".config", "powershell", "Microsoft.PowerShell_profile.ps1")
+		if runtime.GOOS == "windows" {
+			profile = filepath.Join(home, "Documents", "PowerShell", "Microsoft.PowerShell_profile.ps1")
+		}
+		w := &strings.Builder{}
+		err := installCompletion(w, "pwsh", "docker", "/usr/bin/docker", false)
+		require.NoError(t, err)
+		require.Equal(t, "installed completion for docker in "+profile+"\n", w.String())
+		require.Contains(t, readFile(t, profile), "Register-ArgumentCompleter -Native -CommandName 'docker'")
+	})
+
+	t.Run("nushell with XDG_CONFIG_HOME", func(t *testing.T) {
+		setHome(t)
+		configHome := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", configHome)
+		config := filepath.Join(configHome, "nushell", "config.nu")
+		w := &strings.Builder{}
+		err := installCompletion(w, "/usr/bin/nu", "docker", "/usr/bin/docker", false)
+		require.NoError(t, err)
+		require.Equal(t, "installed completion for docker in "+config+"\n", w.String())
+		require.Contains(t, readFile(t, config), "$env.config.completions.external.completer = do {|previous|")
+	})
+
+	for shell, rcFile := range map[string]string{
+		"elvish": filepath.Join(".config", "elvish", "rc.elv"),
+		"xonsh":  ".xonshrc",
+		"tcsh":   ".tcshrc",
+	} {
+		t.Run(shell, func(t *testing.T) {
+			home := setHome(t)
+			if shell == "elvish" && runtime.GOOS == "windows" {
+				t.Skip("elvish uses %AppData% on windows")
+			}
+			path := filepath.Join(home, rcFile)
+			w := &strings.Builder{}
+			err := installCompletion(w, "/usr/bin/"+shell, "docker", "/usr/bin/docker", false)
 			require.NoError(t, err)
-			require.Equal(t, fragment, w.String())
+			require.Equal(t, "installed completion for docker in "+path+"\n", w.String())
+			require.True(t, strings.HasPrefix(readFile(t, path), "# begin kongplete completion for docker\n"))
 		})
 	}
+
+	t.Run("fish completion file not written by kongplete", func(t *testing.T) {
+		home := setHome(t)
+		completionFile := filepath.Join(home, ".config", "fish", "completions", "docker.fish")
+		writeFile(t, completionFile, "complete -c docker -a foo\n")
+		err := installCompletion(&strings.Builder{}, "fish", "docker", "/usr/bin/docker", false)
+		require.EqualError(t, err, completionFile+" exists and wasn't written by kongplete")
+		require.Equal(t, "complete -c docker -a foo\n", readFile(t, completionFile))
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		home := setHome(t)
+		bashrc := filepath.Join(home, ".bashrc")
+		writeFile(t, bashrc, "export FOO=bar\n")
+		w := &strings.Builder{}
+		err := installCompletion(w, "bash", "docker", "/usr/bin/docker", true)
+		require.NoError(t, err)
+		want := "--- " + bashrc + "\n+++ " + bashrc + "\n" +
+			"@@ -1 +1," + strconv.Itoa(strings.Count(block, "\n")+1) + " @@\n export FOO=bar\n" +
+			"+" + strings.ReplaceAll(strings.TrimSuffix(block, "\n"), "\n", "\n+") + "\n"
+		require.Equal(t, want, w.String())
+		require.Equal(t, "export FOO=bar\n", readFile(t, bashrc))
+	})
+
+	t.Run("dry run new file", func(t *testing.T) {
+		home := setHome(t)
+		w := &strings.Builder{}
+		err := installCompletion(w, "fish", "docker", "/usr/bin/docker", true)
+		require.NoError(t, err)
+		completionFile := filepath.Join(home, ".config", "fish", "completions", "docker.fish")
+		require.True(t, strings.HasPrefix(w.String(), "--- /dev/null\n+++ "+completionFile+"\n"))
+		require.NoFileExists(t, completionFile)
+	})
+}
+
+func TestUninstallCompletion(t *testing.T) {
+	block := "# begin kongplete completion for docker\ncomplete -C '/usr/bin/docker __complete' docker\n# end kongplete completion for docker\n"
+
+	t.Run("bash", func(t *testing.T) {
+		home := setHome(t)
+		bashrc := filepath.Join(home, ".bashrc")
+		writeFile(t, bashrc, "export FOO=bar\n"+block+"alias ll='ls -l'\n")
+		w := &strings.Builder{}
+		err := uninstallCompletion(w, "/bin/bash", "docker", false)
+		require.NoError(t, err)
+		require.Equal(t, "removed completion for docker from "+bashrc+"\n", w.String())
+		require.Equal(t, "export FOO=bar\nalias ll='ls -l'\n", readFile(t, bashrc))
+	})
+
+	t.Run("zsh with ZDOTDIR", func(t *testing.T) {
+		setHome(t)
+		zdotdir := t.TempDir()
+		t.Setenv("ZDOTDIR", zdotdir)
+		zshrc := filepath.Join(zdotdir, ".zshrc")
+		writeFile(t, zshrc, block+block)
+		w := &strings.Builder{}
+		err := uninstallCompletion(w, "zsh", "docker", false)
+		require.NoError(t, err)
+		require.Equal(t, "removed completion for docker from "+zshrc+"\n", w.String())
+		require.Equal(t, "", readFile(t, zshrc))
+	})
+
+	t.Run("fish", func(t *testing.T) {
+		home := setHome(t)
+		completionFile := filepath.Join(home, ".config", "fish", "completions", "docker.fish")
+		writeFile(t, completionFile, block)
+		w := &strings.Builder{}
+		err := uninstallCompletion(w, "fish", "docker", false)
+		require.NoError(t, err)
+		require.Equal(t, "removed "+completionFile+"\n", w.String())
+		require.NoFileExists(t, completionFile)
+	})
+
+	t.Run("fish with XDG_CONFIG_HOME", func(t *testing.T) {
+		setHome(t)
+		configHome := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", configHome)
+		completionFile := filepath.Join(configHome, "fish", "completions", "docker.fish")
+		writeFile(t, completionFile, block)
+		err := uninstallCompletion(&strings.Builder{}, "fish", "docker", false)
+		require.NoError(t, err)
+		require.NoFileExists(t, completionFile)
+	})
+
+	t.Run("fish completion file not written by kongplete", func(t *testing.T) {
+		home := setHome(t)
+		completionFile := filepath.Join(home, ".config", "fish", "completions", "docker.fish")
+		writeFile(t, completionFile, "complete -c docker -a foo\n")
+		err := uninstallCompletion(&strings.Builder{}, "fish", "docker", false)
+		require.EqualError(t, err, "no fish completion for docker is installed")
+		require.FileExists(t, completionFile)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		home := setHome(t)
+		completionFile := filepath.Join(home, ".config", "fish", "completions", "docker.fish")
+		writeFile(t, completionFile, block)
+		w := &strings.Builder{}
+		err := uninstallCompletion(w, "fish", "docker", true)
+		require.NoError(t, err)
+		want := `--- ` + completionFile + `
++++ /dev/null
+@@ -1,3 +0,0 @@
+-# begin kongplete completion for docker
+-complete -C '/usr/bin/docker __complete' docker
+-# end kongplete completion for docker
+`
+		require.Equal(t, want, w.String())
+		require.FileExists(t, completionFile)
+	})
+
+	t.Run("nothing installed", func(t *testing.T) {
+		home := setHome(t)
+		writeFile(t, filepath.Join(home, ".bashrc"), "export FOO=bar\n")
+		err := uninstallCompletion(&strings.Builder{}, "bash", "docker", false)
+		require.EqualError(t, err, "no bash completion for docker is installed")
+	})
+
+	t.Run("missing end marker", func(t *testing.T) {
+		home := setHome(t)
+		bashrc := filepath.Join(home, ".bashrc")
+		writeFile(t, bashrc, "# begin kongplete completion for docker\nexport FOO=bar\n")
+		err := uninstallCompletion(&strings.Builder{}, "bash", "docker", false)
+		require.Error(t, err)
+		require.Equal(t, "# begin kongplete completion for docker\nexport FOO=bar\n", readFile(t, bashrc))
+	})
+}
+
+func TestInstallCompletions(t *testing.T) {
+	var cli struct {
+		InstallCompletions InstallCompletions `cmd:""`
+	}
+	newParser := func(t *testing.T, stdout *strings.Builder) *kong.Kong {
+		t.Helper()
+		return kong.Must(&cli, kong.Name("docker"), kong.Writers(stdout, stdout), kong.Exit(func(int) {}))
+	}
+
+	t.Run("shell flag", func(t *testing.T) {
+		home := setHome(t)
+		t.Setenv("SHELL", "/bin/bash")
+		stdout := &strings.Builder{}
+		_, err := newParser(t, stdout).Parse([]string{"install-completions", "--shell", "fish"})
+		require.NoError(t, err)
+		completionFile := filepath.Join(home, ".config", "fish", "completions", "docker.fish")
+		require.Equal(t, "installed completion for docker in "+completionFile+"\n", stdout.String())
+		require.FileExists(t, completionFile)
+	})
+
+	t.Run("unsupported shell flag", func(t *testing.T) {
+		setHome(t)
+		_, err := newParser(t, &strings.Builder{}).Parse([]string{"install-completions", "--shell", "csh"})
+		require.EqualError(t, err, "unsupported shell csh, supported shells are bash, elvish, fish, nushell, powershell, tcsh, xonsh, zsh")
+	})
+
+	t.Run("uninstall", func(t *testing.T) {
+		home := setHome(t)
+		// The shell is detected from $SHELL when the parent process isn't a shell.
+		setParentShell(t, "make\n")
+		t.Setenv("SHELL", "/bin/bash")
+		bashrc := filepath.Join(home, ".bashrc")
+		block := "# begin kongplete completion for docker\ncomplete -C '/usr/bin/docker __complete' docker\n# end kongplete completion for docker\n"
+		writeFile(t, bashrc, "export FOO=bar\n"+block)
+		stdout := &strings.Builder{}
+		_, err := newParser(t, stdout).Parse([]string{"install-completions", "--uninstall"})
+		require.NoError(t, err)
+		require.Equal(t, "removed completion for docker from "+bashrc+"\n", stdout.String())
+		require.Equal(t, "export FOO=bar\n", readFile(t, bashrc))
+	})
+
+	t.Run("uninstall dry run", func(t *testing.T) {
+		home := setHome(t)
+		bashrc := filepath.Join(home, ".bashrc")
+		block := "# begin kongplete completion for docker\ncomplete -C '/usr/bin/docker __complete' docker\n# end kongplete completion for docker\n"
+		writeFile(t, bashrc, block)
+		stdout := &strings.Builder{}
+		_, err := newParser(t, stdout).Parse([]string{"install-completions", "--shell=bash", "--uninstall", "--dry-run"})
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(stdout.String(), "--- "+bashrc+"\n"))
+		require.Equal(t, block, readFile(t, bashrc))
+	})
+
+	t.Run("print", func(t *testing.T) {
+		setHome(t)
+		stdout := &strings.Builder{}
+		_, err := newParser(t, stdout).Parse([]string{"install-completions", "--shell", "bash", "--print"})
+		require.NoError(t, err)
+		require.Contains(t, stdout.String(), "complete -F _docker docker\n")
+	})
+
+	t.Run("complete shell flag", func(t *testing.T) {
+		got := runComplete(t, newParser(t, &strings.Builder{}), "docker install-completions --shell ", nil)
+		require.ElementsMatch(t, []string{"bash", "elvish", "fish", "nushell", "powershell", "tcsh", "xonsh", "zsh"}, got)
+	})
+}
+
+func TestInstallCompletions_globalFlags(t *testing.T) {
+	var cli struct {
+		DryRun    bool
+		Print     bool
+		Uninstall bool
+		Verbose   bool
+		Force     bool
+		Output    string
+		Shell     string
+
+		InstallCompletions struct {
+			InstallCompletions `embed:"" prefix:"completion-"`
+		} `cmd:""`
+	}
+	home := setHome(t)
+	stdout := &strings.Builder{}
+	parser, err := kong.New(&cli, kong.Name("docker"), kong.Writers(stdout, stdout), kong.Exit(func(int) {}))
+	require.NoError(t, err)
+	_, err = parser.Parse([]string{"--dry-run", "--uninstall", "--shell", "zsh", "install-completions", "--completion-shell", "bash", "--completion-dry-run"})
+	require.NoError(t, err)
+	bashrc := filepath.Join(home, ".bashrc")
+	require.True(t, strings.HasPrefix(stdout.String(), "--- /dev/null\n+++ "+bashrc+"\n"))
+	require.NoFileExists(t, bashrc)
+}
+
+// setParentShell makes detectShell see comm as the name of our parent process.
+func setParentShell(t *testing.T, comm string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, strconv.Itoa(os.Getppid()), "comm"), comm)
+	oldProcDir := procDir
+	procDir = dir
+	t.Cleanup(func() { procDir = oldProcDir })
+}
+
+func Test_detectShell(t *testing.T) {
+	t.Run("parent process", func(t *testing.T) {
+		setParentShell(t, "fish\n")
+		t.Setenv("SHELL", "/bin/bash")
+		shell, err := detectShell()
+		require.NoError(t, err)
+		require.Equal(t, "fish", shell)
+	})
+
+	t.Run("login shell parent process", func(t *testing.T) {
+		setParentShell(t, "-zsh\n")
+		t.Setenv("SHELL", "/bin/bash")
+		shell, err := detectShell()
+		require.NoError(t, err)
+		require.Equal(t, "zsh", shell)
+	})
+
+	t.Run("pwsh parent process", func(t *testing.T) {
+		setParentShell(t, "pwsh\n")
+		t.Setenv("SHELL", "/bin/bash")
+		shell, err := detectShell()
+		require.NoError(t, err)
+		require.Equal(t, "powershell", shell)
+	})
+
+	t.Run("SHELL", func(t *testing.T) {
+		setParentShell(t, "make\n")
+		t.Setenv("SHELL", "/usr/local/bin/zsh")
+		shell, err := detectShell()
+		require.NoError(t, err)
+		require.Equal(t, "zsh", shell)
+	})
+
+	t.Run("tcsh", func(t *testing.T) {
+		setParentShell(t, "tcsh\n")
+		t.Setenv("SHELL", "/bin/bash")
+		shell, err := detectShell()
+		require.NoError(t, err)
+		require.Equal(t, "tcsh", shell)
+	})
+
+	t.Run("no supported shell", func(t *testing.T) {
+		setParentShell(t, "make\n")
+		t.Setenv("SHELL", "/bin/csh")
+		_, err := detectShell()
+		require.EqualError(t, err, "couldn't detect a supported shell, use --shell with one of bash, elvish, fish, nushell, powershell, tcsh, xonsh, zsh")
+	})
+}
+
+func setHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("ZDOTDIR", "")
+	t.Setenv("XDG_CONFIG_HOME", "")
+	return home
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o750))
+	require.NoError(t, os.WriteFile(name, []byte(content), 0o600))
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+	content, err := os.ReadFile(name)
+	require.NoError(t, err)
+	return string(content)
 }
@@ -0,0 +1,176 @@
+package kongplete
+
+import (
+	"reflect"
+
+	"github.com/alecthomas/kong"
+	"github.com/posener/complete"
+)
+
+// ContextPredictor is a predictor that can see what kong parsed from the completed args. Use it for values
+// that depend on other values, like a --zone that depends on the --region typed before it.
+type ContextPredictor interface {
+	PredictContext(ctx *PredictContext) []string
+}
+
+// ContextPredictFunc is a function that implements ContextPredictor.
+type ContextPredictFunc func(ctx *PredictContext) []string
+
+// PredictContext implements ContextPredictor
+func (f ContextPredictFunc) PredictContext(ctx *PredictContext) []string {
+	if f == nil {
+		return nil
+	}
+	return f(ctx)
+}
+
+// PredictContext is what a ContextPredictor predicts from.
+type PredictContext struct {
+	complete.Args
+
+	// Command is the path of commands selected by the completed args, not including the application name.
+	Command []string
+
+	// Flags holds the values kong parsed for flags in the completed args, keyed by flag name. Flags that aren't
+	// in the completed args aren't included.
+	Flags map[string]interface{}
+
+	// Positionals holds the values kong parsed for positional arguments in the completed args, in order.
+	Positionals []interface{}
+
+	// MapKey is the key of the map element whose value is predicted when the predictor is the predictor-value
+	// predictor of a map. It is "" otherwise.
+	MapKey string
+
+	// Kong is kong's trace of the completed args. Anything the trace applies to the CLI struct or the model is
+	// restored before the predictor runs. Errors from the trace, like a missing flag value, are in Kong.Error.
+	Kong *kong.Context
+}
+
+// WithContextPredictor use the named context predictor. It is selected with the predictor tag just like
+// predictors from WithPredictor.
+func WithContextPredictor(name string, predictor ContextPredictor) Option {
+	return func(o *options) {
+		if o.contextPredictors == nil {
+			o.contextPredictors = map[string]ContextPredictor{}
+		}
+		o.contextPredictors[name] = predictor
+	}
+}
+
+// trace traces the completed args of a completion through kong.
+type trace struct {
+	parser *kong.Kong
+	// completed are the completed args of the line being completed when complete is true. complete is false for
+	// the predictors of Command, which can be used with any number of lines.
+	completed []string
+	complete  bool
+}
+
+// context returns the trace of the args completed before a. It doesn't include complete.Args. It is traced for
+// every prediction, so predictors reused for another line don't see the previous one.
+func (t *trace) context(a complete.Args) *PredictContext {
+	completed := t.completed
+	if !t.complete {
+		completed = commandCompleted(a)
+	}
+	ctx := &PredictContext{
+		Flags: map[string]interface{}{},
+	}
+	if t.parser == nil {
+		return ctx
+	}
+	restore := saveModel(t.parser.Model)
+	kctx, err := kong.Trace(t.parser, completed)
+	restore()
+	if err != nil {
+		complete.Log("Failed tracing %v: %v", completed, err)
+		return ctx
+	}
+	ctx.Kong = kctx
+	for _, path := range kctx.Path {
+		switch {
+		case path.Command != nil:
+			ctx.Command = append(ctx.Command, path.Command.Name)
+		case path.Flag != nil:
+			ctx.Flags[path.Flag.Name] = kctx.Value(path).Interface()
+		case path.Positional != nil, path.Argument != nil:
+			ctx.Positionals = append(ctx.Positionals, kctx.Value(path).Interface())
+		}
+	}
+	return ctx
+}
+
+// saveModel saves the state kong.Trace changes in model and returns a func that restores it. Tracing a negated
+// flag marks it Negated and applies its value to the CLI struct, which would leak into the application's parse.
+func saveModel(model *kong.Application) func() {
+	var restores []func()
+	_ = kong.Visit(model, func(node kong.Visitable, next kong.Next) error {
+		switch node := node.(type) {
+		case *kong.Application:
+			active := node.Active
+			restores = append(restores, func() { node.Active = active })
+		case *kong.Node:
+			active := node.Active
+			restores = append(restores, func() { node.Active = active })
+		case *kong.Flag:
+			negated := node.Negated
+			restores = append(restores, func() { node.Negated = negated })
+		case *kong.Value:
+			active, set := node.Active, node.Set
+			var target reflect.Value
+			if node.Target.IsValid() {
+				target = reflect.New(node.Target.Type()).Elem()
+				target.Set(node.Target)
+			}
+			restores = append(restores, func() {
+				node.Active, node.Set = active, set
+				if target.IsValid() && node.Target.CanSet() {
+					node.Target.Set(target)
+				}
+			})
+		}
+		return next(nil)
+	})
+	return func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}
+}
+
+// commandCompleted returns the completed args of the line a is from for the predictors of Command. Sub-commands
+// predict with the args after their name, so the completed args of COMP_LINE are used when a is from it.
+func commandCompleted(a complete.Args) []string {
+	line, ok := compLine()
+	if !ok {
+		return a.Completed
+	}
+	la := newArgs(line)
+	if la.Last != a.Last || len(la.Completed) < len(a.Completed) {
+		return a.Completed
+	}
+	offset := len(la.Completed) - len(a.Completed)
+	for i, arg := range a.Completed {
+		if la.Completed[offset+i] != arg {
+			return a.Completed
+		}
+	}
+	return la.Completed
+}
+
+// contextPredictor adapts a ContextPredictor to complete.Predictor.
+type contextPredictor struct {
+	predictor ContextPredictor
+	trace     *trace
+	// mapKey is the key of the map element whose value is predicted.
+	mapKey string
+}
+
+// Predict implements complete.Predictor
+func (p *contextPredictor) Predict(a complete.Args) []string {
+	ctx := p.trace.context(a)
+	ctx.Args = a
+	ctx.MapKey = p.mapKey
+	return p.predictor.PredictContext(ctx)
+}
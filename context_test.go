@@ -0,0 +1,137 @@
+package kongplete
+
+import (
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComplete_contextPredictors(t *testing.T) {
+	zones := map[string][]string{
+		"us-east": {"us-east-1a", "us-east-1b"},
+		"eu-west": {"eu-west-1a"},
+	}
+	zonePredictor := ContextPredictFunc(func(ctx *PredictContext) []string {
+		region, _ := ctx.Flags["region"].(string)
+		return zones[region]
+	})
+
+	var got *PredictContext
+	recorder := ContextPredictFunc(func(ctx *PredictContext) []string {
+		got = ctx
+		return []string{"recorded"}
+	})
+
+	var cli struct {
+		Region  string `kong:"short=r"`
+		Verbose bool   `kong:"short=v"`
+		Compute struct {
+			Create struct {
+				Zone  string   `kong:"predictor=zone"`
+				Name  string   `kong:"arg"`
+				Other []string `kong:"arg,predictor=recorder"`
+			} `kong:"cmd"`
+		} `kong:"cmd"`
+	}
+
+	for _, td := range []completeTest{
+		{parser: kong.Must(&cli), want: []string{"us-east-1a", "us-east-1b"}, line: "myApp --region us-east compute create --zone "},
+		{parser: kong.Must(&cli), want: []string{"eu-west-1a"}, line: "myApp compute create -r eu-west --zone "},
+		{parser: kong.Must(&cli), want: []string{"eu-west-1a"}, line: "myApp compute create --region=eu-west --zone "},
+		{parser: kong.Must(&cli), want: []string{"us-east-1a"}, line: "myApp compute create --region=us-east --zone us-east-1a"},
+		{parser: kong.Must(&cli), want: []string{}, line: "myApp compute create --zone "},
+	} {
+		t.Run(td.line, func(t *testing.T) {
+			options := []Option{
+				WithContextPredictor("zone", zonePredictor),
+				WithContextPredictor("recorder", recorder),
+			}
+			got := runComplete(t, td.parser, td.line, options)
+			assert.ElementsMatch(t, td.want, got)
+		})
+	}
+
+	t.Run("context", func(t *testing.T) {
+		options := []Option{
+			WithContextPredictor("zone", zonePredictor),
+			WithContextPredictor("recorder", recorder),
+		}
+		res := runComplete(t, kong.Must(&cli), "myApp -v compute create --region us-east foo bar r", options)
+		assert.Equal(t, []string{"recorded"}, res)
+		assert.Equal(t, []string{"compute", "create"}, got.Command)
+		assert.Equal(t, map[string]interface{}{"verbose": true, "region": "us-east"}, got.Flags)
+		assert.Equal(t, []interface{}{"foo", []string{"bar"}}, got.Positionals)
+		assert.Equal(t, "r", got.Last)
+		assert.NotNil(t, got.Kong)
+	})
+}
+
+func TestCommand_contextPredictors(t *testing.T) {
+	zones := map[string][]string{
+		"us-east": {"us-east-1a", "us-east-1b"},
+		"eu-west": {"eu-west-1a"},
+	}
+	zonePredictor := ContextPredictFunc(func(ctx *PredictContext) []string {
+		region, _ := ctx.Flags["region"].(string)
+		return zones[region]
+	})
+
+	var cli struct {
+		Region  string
+		Zone    string `kong:"predictor=zone"`
+		Compute struct {
+			Location string `kong:"predictor=zone"`
+		} `kong:"cmd"`
+	}
+	cmd, err := Command(kong.Must(&cli), WithContextPredictor("zone", zonePredictor))
+	require.NoError(t, err)
+
+	for _, td := range []struct {
+		line    string
+		setLine bool
+		want    []string
+	}{
+		{line: "myApp --region us-east --zone ", want: []string{"us-east-1a", "us-east-1b"}},
+		{line: "myApp --region eu-west --zone ", want: []string{"eu-west-1a"}},
+		{line: "myApp --region us-east compute --location ", setLine: true, want: []string{"us-east-1a", "us-east-1b"}},
+		{line: "myApp --region eu-west compute --location ", setLine: true, want: []string{"eu-west-1a"}},
+	} {
+		t.Run(td.line, func(t *testing.T) {
+			t.Setenv(envLine, "")
+			if td.setLine {
+				t.Setenv(envLine, td.line)
+			}
+			assert.ElementsMatch(t, td.want, cmd.Predict(newArgs(td.line)))
+		})
+	}
+}
+
+func TestCommand_contextPredictorsKeepParse(t *testing.T) {
+	var cli struct {
+		Color bool   `kong:"negatable,default=true"`
+		Other string `kong:"predictor=recorder"`
+	}
+	parser := kong.Must(&cli)
+	recorder := ContextPredictFunc(func(ctx *PredictContext) []string {
+		color, _ := ctx.Flags["color"].(bool)
+		assert.False(t, color)
+		return []string{"recorded"}
+	})
+	_, err := parser.Parse(nil)
+	require.NoError(t, err)
+	cmd, err := Command(parser, WithContextPredictor("recorder", recorder))
+	require.NoError(t, err)
+	t.Setenv(envLine, "")
+
+	assert.Equal(t, []string{"recorded"}, cmd.Predict(newArgs("myApp --no-color --other ")))
+	assert.True(t, cli.Color)
+
+	_, err = parser.Parse([]string{"--color"})
+	require.NoError(t, err)
+	assert.True(t, cli.Color)
+	_, err = parser.Parse([]string{"--no-color"})
+	require.NoError(t, err)
+	assert.False(t, cli.Color)
+}
@@ -0,0 +1,54 @@
+package kongplete
+
+import (
+	"github.com/posener/complete"
+)
+
+// Directive tells shells how to complete the last arg besides the candidates. Directives are combined with |.
+// Shells that can't follow a directive ignore it.
+type Directive int
+
+const (
+	// DirectiveNoSpace tells shells not to add a space after the completed candidate, like after "--flag=" or a
+	// path ending in "/".
+	DirectiveNoSpace Directive = 1 << iota
+	// DirectiveNoFallback tells shells that fall back to completing paths when there are no candidates, like
+	// nushell, not to. bash, zsh and fish only complete paths when told to.
+	DirectiveNoFallback
+	// DirectiveFiles tells shells to complete files themselves, with their own quoting and tilde handling.
+	DirectiveFiles
+	// DirectiveDirs tells shells to complete directories themselves.
+	DirectiveDirs
+)
+
+// DirectivePredictor is a complete.Predictor that can also give directives for its predictions.
+type DirectivePredictor interface {
+	complete.Predictor
+	PredictDirective(a complete.Args) Directive
+}
+
+// PredictWithDirective adds directive to the predictions of predictor, which may be nil to only give the directive.
+func PredictWithDirective(predictor complete.Predictor, directive Directive) DirectivePredictor {
+	return &directivePredictor{
+		Predictor: predictor,
+		directive: directive,
+	}
+}
+
+type directivePredictor struct {
+	complete.Predictor
+	directive Directive
+}
+
+// Predict implements complete.Predictor
+func (p *directivePredictor) Predict(a complete.Args) []string {
+	if p.Predictor == nil {
+		return nil
+	}
+	return p.Predictor.Predict(a)
+}
+
+// PredictDirective implements DirectivePredictor
+func (p *directivePredictor) PredictDirective(complete.Args) Directive {
+	return p.directive
+}
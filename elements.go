@@ -0,0 +1,101 @@
+package kongplete
+
+import (
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/posener/complete"
+)
+
+// elementsPredictor predicts the values of slice and map flags element by element, like "a,b,c" for a slice
+// with the default separator. The predictor predicts the element being typed, and its candidates are prefixed
+// with the elements already typed, leaving out those already present.
+type elementsPredictor struct {
+	predictor complete.Predictor
+	sep       string
+	// isMap is true when elements are "key=value" and elements with a key already present are left out.
+	isMap bool
+}
+
+// newElementsPredictor returns a predictor for the elements of value, or predictor itself when value isn't a
+// slice or map, has no separator or predictor has no candidates.
+func newElementsPredictor(value *kong.Value, predictor complete.Predictor) complete.Predictor {
+	if value == nil || value.Tag == nil {
+		return predictor
+	}
+	if p, ok := predictor.(predictCandidates); ok && len(p) == 0 {
+		return predictor
+	}
+	var sep rune
+	switch {
+	case value.IsSlice():
+		sep = value.Tag.Sep
+	case value.IsMap():
+		sep = value.Tag.MapSep
+	default:
+		return predictor
+	}
+	if sep == -1 {
+		return predictor
+	}
+	return &elementsPredictor{
+		predictor: predictor,
+		sep:       string(sep),
+		isMap:     value.IsMap(),
+	}
+}
+
+// Predict implements complete.Predictor
+func (p *elementsPredictor) Predict(a complete.Args) []string {
+	candidates := p.PredictDescribed(a)
+	values := make([]string, len(candidates))
+	for i, c := range candidates {
+		values[i] = c.Value
+	}
+	return values
+}
+
+// PredictDescribed implements DescribedPredictor
+func (p *elementsPredictor) PredictDescribed(a complete.Args) []Candidate {
+	prefix, ea, present := p.split(a)
+	candidates := describedPredictions(p.predictor, ea)
+	return p.prefixed(candidates, prefix, present)
+}
+
+// split splits the last arg into the elements already typed, including the last separator, and args to predict
+// the element being typed with. present holds the typed elements or, for maps, their keys.
+func (p *elementsPredictor) split(a complete.Args) (prefix string, ea complete.Args, present map[string]bool) {
+	ea = a
+	i := strings.LastIndex(a.Last, p.sep)
+	if i == -1 {
+		return "", ea, nil
+	}
+	prefix, ea.Last = a.Last[:i+len(p.sep)], a.Last[i+len(p.sep):]
+	present = map[string]bool{}
+	for _, element := range strings.Split(a.Last[:i], p.sep) {
+		present[p.key(element)] = true
+	}
+	return prefix, ea, present
+}
+
+// prefixed returns the candidates that aren't present with prefix added to their values.
+func (p *elementsPredictor) prefixed(candidates []Candidate, prefix string, present map[string]bool) []Candidate {
+	res := make([]Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if present[p.key(c.Value)] {
+			continue
+		}
+		c.Value = prefix + c.Value
+		res = append(res, c)
+	}
+	return res
+}
+
+// key returns what identifies an element: the key of a map element or the whole element.
+func (p *elementsPredictor) key(element string) string {
+	if !p.isMap {
+		return element
+	}
+	key, _, _ := strings.Cut(element, "=")
+	return key
+}
@@ -7,7 +7,6 @@ import (
 	"os"
 
 	"github.com/alecthomas/kong"
-	"github.com/posener/complete"
 	"github.com/willabides/kongplete"
 )
 
@@ -42,7 +41,7 @@ func Example() {
 
 	// Run kongplete.Complete to handle completion requests
 	kongplete.Complete(parser,
-		kongplete.WithPredictor("file", complete.PredictFiles("*")),
+		kongplete.WithPredictor("file", kongplete.PredictFiles("*")),
 	)
 
 	// Proceed as normal after kongplete.Complete.
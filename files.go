@@ -0,0 +1,45 @@
+package kongplete
+
+import (
+	"github.com/posener/complete"
+)
+
+// PredictFiles is like complete.PredictFiles, but shells that can complete paths themselves, like zsh, do so
+// instead. It is the default "file" predictor.
+func PredictFiles(pattern string) complete.Predictor {
+	return newFilesPredictor(pattern, false)
+}
+
+// PredictDirs is like complete.PredictDirs, but shells that can complete paths themselves, like zsh, do so
+// instead. It is the default "dir" predictor.
+func PredictDirs(pattern string) complete.Predictor {
+	return newFilesPredictor(pattern, true)
+}
+
+func newFilesPredictor(pattern string, dirs bool) *filesPredictor {
+	predictor := complete.PredictFiles(pattern)
+	if dirs {
+		predictor = complete.PredictDirs(pattern)
+	}
+	return &filesPredictor{
+		Predictor: predictor,
+		pattern:   pattern,
+		dirs:      dirs,
+	}
+}
+
+// filesPredictor predicts paths matching pattern.
+type filesPredictor struct {
+	complete.Predictor
+	pattern string
+	// dirs is true when only directories are predicted.
+	dirs bool
+}
+
+// directive returns the rich format directive for shells to complete the paths themselves.
+func (p *filesPredictor) directive() string {
+	if p.dirs {
+		return "dirs " + p.pattern
+	}
+	return "files " + p.pattern
+}
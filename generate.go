@@ -0,0 +1,83 @@
+package kongplete
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/alecthomas/kong"
+)
+
+// GenerateCompletions is a kong command that writes completion scripts for every supported shell to a directory.
+// It is meant for release packaging, so it is usually added with a `hidden:""` tag.
+type GenerateCompletions struct {
+	Dir string `arg:"" type:"path" help:"Directory to write the completion scripts to."`
+}
+
+// BeforeApply writes the completion scripts.
+func (c *GenerateCompletions) BeforeApply(ctx *kong.Context) error {
+	traceValues(ctx, &c.Dir)
+	// Without a directory, leave it to kong to report the missing argument.
+	if c.Dir == "" {
+		return nil
+	}
+	err := GenerateAll(ctx.Kong, c.Dir)
+	if err != nil {
+		return err
+	}
+	ctx.Exit(0)
+	return nil
+}
+
+// GenerateAll writes completion scripts for every supported shell to dir using each shell's conventional file
+// name, like "app.bash", "_app" and "app.fish". The scripts run the binary by its name, so it has to be on the
+// user's PATH. dir is created when it doesn't exist.
+func GenerateAll(parser *kong.Kong, dir string) error {
+	if parser == nil || parser.Model == nil {
+		return fmt.Errorf("can't generate completions without a parser")
+	}
+	return generateAll(dir, parser.Model.Name, parser.Model.Name)
+}
+
+// generateAll writes completion scripts for cmd to dir.
+func generateAll(dir, cmd, bin string) error {
+	err := os.MkdirAll(dir, 0o755) //nolint:gosec // release artifacts are installed for every user to read
+	if err != nil {
+		return err
+	}
+	for _, shell := range supportedShells() {
+		script, err := completionScript(shell, cmd, bin)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, completionFileName(shell, cmd))
+		err = os.WriteFile(path, []byte(script), 0o644) //nolint:gosec // release artifacts are installed for every user to read
+		if err != nil {
+			return fmt.Errorf("couldn't write %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// completionFileName returns the name a completion script for cmd is conventionally packaged as.
+func completionFileName(shell, cmd string) string {
+	switch shellName(shell) {
+	case "bash":
+		return cmd + ".bash"
+	case "zsh":
+		return "_" + cmd
+	case "fish":
+		return cmd + ".fish"
+	case "powershell":
+		return cmd + ".ps1"
+	case "nushell":
+		return cmd + ".nu"
+	case "elvish":
+		return cmd + ".elv"
+	case "xonsh":
+		return cmd + ".xsh"
+	case "tcsh":
+		return cmd + ".tcsh"
+	}
+	return cmd + "." + shellName(shell)
+}
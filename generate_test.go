@@ -0,0 +1,89 @@
+package kongplete
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateAll(t *testing.T) {
+	var cli struct{}
+	parser := kong.Must(&cli, kong.Name("docker"))
+	dir := filepath.Join(t.TempDir(), "completions")
+	require.NoError(t, GenerateAll(parser, dir))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	require.Equal(t, []string{
+		"_docker",
+		"docker.bash",
+		"docker.elv",
+		"docker.fish",
+		"docker.nu",
+		"docker.ps1",
+		"docker.tcsh",
+		"docker.xsh",
+	}, names)
+
+	require.Contains(t, readFile(t, filepath.Join(dir, "docker.bash")), "docker' __complete ")
+
+	// The modes are compared to files made with the same permissions so the umask doesn't matter.
+	probeDir := filepath.Join(t.TempDir(), "probe")
+	require.NoError(t, os.Mkdir(probeDir, 0o755))
+	probeFile := filepath.Join(probeDir, "probe")
+	require.NoError(t, os.WriteFile(probeFile, nil, 0o644))
+	require.Equal(t, fileMode(t, probeDir), fileMode(t, dir))
+	require.Equal(t, fileMode(t, probeFile), fileMode(t, filepath.Join(dir, "docker.bash")))
+	for _, shell := range supportedShells() {
+		want, err := completionScript(shell, "docker", "docker")
+		require.NoError(t, err)
+		require.Equal(t, want, readFile(t, filepath.Join(dir, completionFileName(shell, "docker"))))
+	}
+}
+
+func TestGenerateAll_nilParser(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "completions")
+	require.EqualError(t, GenerateAll(nil, dir), "can't generate completions without a parser")
+	require.NoDirExists(t, dir)
+}
+
+func TestGenerateCompletions(t *testing.T) {
+	var cli struct {
+		GenerateCompletions GenerateCompletions `cmd:"" hidden:""`
+	}
+	var exited bool
+	parser := kong.Must(&cli, kong.Name("docker"), kong.Exit(func(int) { exited = true }))
+	dir := t.TempDir()
+	_, err := parser.Parse([]string{"generate-completions", dir})
+	require.NoError(t, err)
+	assert.True(t, exited)
+	assert.Contains(t, readFile(t, filepath.Join(dir, "docker.bash")), "complete -F _docker docker\n")
+	assert.True(t, strings.HasPrefix(readFile(t, filepath.Join(dir, "_docker")), "#compdef docker\n"))
+}
+
+func TestGenerateCompletions_noDir(t *testing.T) {
+	var cli struct {
+		GenerateCompletions GenerateCompletions `cmd:"" hidden:""`
+	}
+	parser := kong.Must(&cli, kong.Name("docker"), kong.Exit(func(int) {}))
+	_, err := parser.Parse([]string{"generate-completions"})
+	require.EqualError(t, err, `expected "<dir>"`)
+}
+
+func fileMode(t *testing.T, path string) os.FileMode {
+	t.Helper()
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	return info.Mode()
+}
@@ -2,6 +2,7 @@ package positionalpredictor
 
 import (
 	"strings"
+	"unicode/utf8"
 
 	"github.com/posener/complete"
 )
@@ -12,17 +13,40 @@ type PositionalPredictor struct {
 	ArgFlags     []string
 	BoolFlags    []string
 	IsCumulative bool
+	// Passthrough is true when the last predictor is for a passthrough argument. Once that argument starts,
+	// the rest of the line belongs to it and its predictor receives the args as if they were the whole line.
+	Passthrough bool
 }
 
 // Predict implements complete.Predict
 func (p *PositionalPredictor) Predict(a complete.Args) []string {
-	predictor := p.predictor(a)
+	predictor, a := p.Predictor(a)
 	if predictor == nil {
 		return []string{}
 	}
 	return predictor.Predict(a)
 }
 
+// Predictor returns the predictor for a.Last along with the args to pass it. Passthrough arguments get the args
+// from the start of the argument. The predictor is nil when there isn't one.
+func (p *PositionalPredictor) Predictor(a complete.Args) (complete.Predictor, complete.Args) {
+	predictor := p.predictor(a)
+	if predictor == nil {
+		return nil, a
+	}
+	if _, _, start := p.scan(a); start >= 0 {
+		a = argsFrom(a, start)
+	}
+	return predictor, a
+}
+
+// EndOfFlags returns true when a.Last can only be a positional argument, either because it follows "--" or
+// because it belongs to a passthrough argument that has already started.
+func (p *PositionalPredictor) EndOfFlags(a complete.Args) bool {
+	_, endOfFlags, _ := p.scan(a)
+	return endOfFlags
+}
+
 func (p *PositionalPredictor) predictor(a complete.Args) complete.Predictor {
 	position := p.predictorIndex(a)
 	complete.Log("predicting positional argument(%d)", position)
@@ -37,54 +61,109 @@ func (p *PositionalPredictor) predictor(a complete.Args) complete.Predictor {
 
 // predictorIndex returns the index in predictors to use. Returns -1 if no predictor should be used.
 func (p *PositionalPredictor) predictorIndex(a complete.Args) int {
-	idx := 0
+	idx, _, _ := p.scan(a)
+	return idx
+}
+
+// scan walks the completed args the way kong parses them. It returns the index in predictors to use for a.Last,
+// whether flag parsing has ended and the position in a.All where a passthrough argument starts, or -1.
+func (p *PositionalPredictor) scan(a complete.Args) (idx int, endOfFlags bool, passthroughStart int) {
 	for i := 0; i < len(a.Completed); i++ {
-		if !p.nonPredictorPos(a, i) {
-			idx++
+		val := a.Completed[i]
+		if !endOfFlags {
+			if val == "--" {
+				endOfFlags = true
+				continue
+			}
+			isFlag, takesArg := p.parseFlag(val)
+			if takesArg {
+				// skip the flag's argument
+				i++
+				continue
+			}
+			if isFlag {
+				continue
+			}
+		}
+		if p.isPassthrough(idx) {
+			return idx, true, i
 		}
+		idx++
 	}
-	return idx
+	if p.isPassthrough(idx) {
+		return idx, endOfFlags, len(a.Completed)
+	}
+	return idx, endOfFlags, -1
 }
 
-// nonPredictorPos returns true if the value at this position is either a flag or a flag's argument
-func (p *PositionalPredictor) nonPredictorPos(a complete.Args, pos int) bool {
-	if pos < 0 || pos > len(a.All)-1 {
-		return false
-	}
-	val := a.All[pos]
-	if p.valIsFlag(val) {
-		return true
+func (p *PositionalPredictor) isPassthrough(idx int) bool {
+	return p.Passthrough && idx == len(p.Predictors)-1
+}
+
+// argsFrom returns a copy of a starting at position i.
+func argsFrom(a complete.Args, i int) complete.Args {
+	if i > len(a.Completed) {
+		i = len(a.Completed)
 	}
-	if pos == 0 {
-		return false
+	a.All = a.All[i:]
+	a.Completed = a.Completed[i:]
+	a.LastCompleted = ""
+	if len(a.Completed) > 0 {
+		a.LastCompleted = a.Completed[len(a.Completed)-1]
 	}
-	prev := a.All[pos-1]
-	return p.nextValueIsFlagArg(prev)
+	return a
 }
 
-// valIsFlag returns true if the value matches a flag from the configuration
-func (p *PositionalPredictor) valIsFlag(val string) bool {
-	val = strings.Split(val, "=")[0]
-	for _, flag := range p.BoolFlags {
-		if flag == val {
-			return true
+// ShortFlagArg parses val as a cluster of short flags. When the cluster ends with a flag that takes an argument,
+// it returns that flag and the argument attached to it. For example "-vuroot" returns "-u" and "root" when "-v"
+// is a BoolFlag and "-u" is an ArgFlag.
+func (p *PositionalPredictor) ShortFlagArg(val string) (flag, arg string, ok bool) {
+	_, flag, arg = p.parseShortFlags(val)
+	return flag, arg, flag != ""
+}
+
+// parseFlag returns whether val is a flag from the configuration, and whether the flag takes the next value as
+// its argument.
+func (p *PositionalPredictor) parseFlag(val string) (isFlag, takesArg bool) {
+	if strings.HasPrefix(val, "--") {
+		name, _, hasArg := strings.Cut(val, "=")
+		switch {
+		case contains(p.BoolFlags, name):
+			return true, false
+		case contains(p.ArgFlags, name):
+			return true, !hasArg
+		default:
+			return false, false
 		}
 	}
-	for _, flag := range p.ArgFlags {
-		if flag == val {
-			return true
+	n, argFlag, arg := p.parseShortFlags(val)
+	return n > 0, argFlag != "" && arg == ""
+}
+
+// parseShortFlags parses val as a cluster of short flags the way kong's scanner does. Each character is a
+// flag until one that takes an argument, and the rest of val is that flag's argument. It returns the number
+// of flags parsed along with the flag that takes an argument and its attached argument.
+func (p *PositionalPredictor) parseShortFlags(val string) (n int, argFlag, arg string) {
+	if len(val) < 2 || val[0] != '-' || val[1] == '-' {
+		return 0, "", ""
+	}
+	for i, r := range val[1:] {
+		short := "-" + string(r)
+		switch {
+		case contains(p.ArgFlags, short):
+			return n + 1, short, val[1+i+utf8.RuneLen(r):]
+		case contains(p.BoolFlags, short):
+			n++
+		default:
+			return n, "", ""
 		}
 	}
-	return false
+	return n, "", ""
 }
 
-// nextValueIsFlagArg returns true if the value matches an ArgFlag and doesn't contain an equal sign.
-func (p *PositionalPredictor) nextValueIsFlagArg(val string) bool {
-	if strings.Contains(val, "=") {
-		return false
-	}
-	for _, flag := range p.ArgFlags {
-		if flag == val {
+func contains(list []string, val string) bool {
+	for _, s := range list {
+		if s == val {
 			return true
 		}
 	}
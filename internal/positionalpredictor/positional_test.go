@@ -34,6 +34,181 @@ func TestPositionalPredictor_position(t *testing.T) {
 	}
 }
 
+func TestPositionalPredictor_parentFlags(t *testing.T) {
+	// ArgFlags and BoolFlags hold the flags of the command and its parents.
+	posPredictor := &PositionalPredictor{
+		BoolFlags: []string{"--sub-bool", "--parent-bool", "-p", "--help", "-h"},
+		ArgFlags:  []string{"--sub-arg", "--parent-arg", "-P"},
+	}
+
+	for _, td := range []struct {
+		args string
+		want int
+	}{
+		{args: `--parent-arg val `, want: 0},
+		{args: `--parent-arg val foo `, want: 1},
+		{args: `foo --parent-arg val `, want: 1},
+		{args: `foo --parent-arg val bar `, want: 2},
+		{args: `foo -P val bar `, want: 2},
+		{args: `foo -P=val bar `, want: 2},
+		{args: `-p foo --sub-arg val bar `, want: 2},
+		{args: `--parent-bool foo --help bar `, want: 2},
+		{args: `--sub-arg val --parent-arg val foo `, want: 1},
+		{args: `foo --parent-arg `, want: 1},
+	} {
+		t.Run(td.args, func(t *testing.T) {
+			got := posPredictor.predictorIndex(newArgs("sub " + td.args))
+			assert.Equal(t, td.want, got)
+		})
+	}
+}
+
+func TestPositionalPredictor_shortFlagClusters(t *testing.T) {
+	posPredictor := &PositionalPredictor{
+		BoolFlags: []string{"-r", "-f"},
+		ArgFlags:  []string{"-u"},
+	}
+
+	for _, td := range []struct {
+		args string
+		want int
+	}{
+		{args: `-rf `, want: 0},
+		{args: `-rf foo `, want: 1},
+		{args: `-fr foo bar `, want: 2},
+		{args: `-uroot foo `, want: 1},
+		{args: `-ruroot foo `, want: 1},
+		{args: `-ru root foo `, want: 1},
+		{args: `-rfu root `, want: 0},
+		{args: `-ur foo `, want: 1},
+		{args: `-x foo `, want: 2},
+		{args: `-rx foo `, want: 1},
+		{args: `- foo `, want: 2},
+	} {
+		t.Run(td.args, func(t *testing.T) {
+			got := posPredictor.predictorIndex(newArgs("rm " + td.args))
+			assert.Equal(t, td.want, got)
+		})
+	}
+}
+
+func TestPositionalPredictor_ShortFlagArg(t *testing.T) {
+	posPredictor := &PositionalPredictor{
+		BoolFlags: []string{"-r", "-f"},
+		ArgFlags:  []string{"-u"},
+	}
+
+	for _, td := range []struct {
+		val      string
+		wantFlag string
+		wantArg  string
+		wantOK   bool
+	}{
+		{val: "-u", wantFlag: "-u", wantOK: true},
+		{val: "-uroot", wantFlag: "-u", wantArg: "root", wantOK: true},
+		{val: "-rfu", wantFlag: "-u", wantOK: true},
+		{val: "-rfur", wantFlag: "-u", wantArg: "r", wantOK: true},
+		{val: "-rf"},
+		{val: "-xu"},
+		{val: "--u"},
+		{val: "u"},
+	} {
+		t.Run(td.val, func(t *testing.T) {
+			flag, arg, ok := posPredictor.ShortFlagArg(td.val)
+			assert.Equal(t, td.wantFlag, flag)
+			assert.Equal(t, td.wantArg, arg)
+			assert.Equal(t, td.wantOK, ok)
+		})
+	}
+}
+
+func TestPositionalPredictor_endOfFlags(t *testing.T) {
+	posPredictor := &PositionalPredictor{
+		BoolFlags: []string{"--mybool", "-b"},
+		ArgFlags:  []string{"--myarg", "-a"},
+	}
+
+	for _, td := range []struct {
+		args           string
+		want           int
+		wantEndOfFlags bool
+	}{
+		{args: `--`, want: 0},
+		{args: `-- `, want: 0, wantEndOfFlags: true},
+		{args: `-- -b `, want: 1, wantEndOfFlags: true},
+		{args: `-b -- -b --myarg foo `, want: 3, wantEndOfFlags: true},
+		{args: `foo -- -- `, want: 2, wantEndOfFlags: true},
+		{args: `--myarg -- foo `, want: 1},
+	} {
+		t.Run(td.args, func(t *testing.T) {
+			a := newArgs("foo " + td.args)
+			assert.Equal(t, td.want, posPredictor.predictorIndex(a))
+			assert.Equal(t, td.wantEndOfFlags, posPredictor.EndOfFlags(a))
+		})
+	}
+}
+
+func TestPositionalPredictor_passthrough(t *testing.T) {
+	var got complete.Args
+	predictor1 := complete.PredictSet("1")
+	passthrough := complete.PredictFunc(func(a complete.Args) []string {
+		got = a
+		return []string{"passthrough"}
+	})
+	posPredictor := &PositionalPredictor{
+		Predictors:   []complete.Predictor{predictor1, passthrough},
+		BoolFlags:    []string{"-b"},
+		IsCumulative: true,
+		Passthrough:  true,
+	}
+
+	for _, td := range []struct {
+		args           string
+		want           []string
+		wantArgs       complete.Args
+		wantEndOfFlags bool
+	}{
+		{
+			args: `-b `,
+			want: []string{"1"},
+		},
+		{
+			args:     `foo -b `,
+			want:     []string{"passthrough"},
+			wantArgs: complete.Args{All: []string{""}, Completed: []string{}, Last: ""},
+		},
+		{
+			args: `foo ls -b `,
+			want: []string{"passthrough"},
+			wantArgs: complete.Args{
+				All:           []string{"ls", "-b", ""},
+				Completed:     []string{"ls", "-b"},
+				LastCompleted: "-b",
+			},
+			wantEndOfFlags: true,
+		},
+		{
+			args: `foo -- -b l`,
+			want: []string{"passthrough"},
+			wantArgs: complete.Args{
+				All:           []string{"-b", "l"},
+				Completed:     []string{"-b"},
+				Last:          "l",
+				LastCompleted: "-b",
+			},
+			wantEndOfFlags: true,
+		},
+	} {
+		t.Run(td.args, func(t *testing.T) {
+			got = complete.Args{}
+			a := newArgs("app " + td.args)
+			assert.Equal(t, td.want, posPredictor.Predict(a))
+			assert.Equal(t, td.wantArgs, got)
+			assert.Equal(t, td.wantEndOfFlags, posPredictor.EndOfFlags(a))
+		})
+	}
+}
+
 func TestPositionalPredictor_predictor(t *testing.T) {
 	predictor1 := complete.PredictSet("1")
 	predictor2 := complete.PredictSet("2")
@@ -2,24 +2,62 @@ package kongplete
 
 import (
 	"fmt"
+	"os"
+	"reflect"
+	"strings"
 
 	"github.com/alecthomas/kong"
 	"github.com/posener/complete"
 	"github.com/willabides/kongplete/internal/positionalpredictor"
 )
 
-const predictorTag = "predictor"
+const (
+	predictorTag = "predictor"
+
+	// filePredictorName and dirPredictorName are the predictors used for values kong reads as files or
+	// directories. They default to PredictFiles("*") and PredictDirs("*").
+	filePredictorName = "file"
+	dirPredictorName  = "dir"
+
+	// completeCmd is the hidden command shells run for completions, as in "app __complete <args...>".
+	completeCmd = "__complete"
+
+	// wordBreaks are the characters of bash's default COMP_WORDBREAKS other than whitespace. readline only replaces
+	// the part of the word after the last of them.
+	wordBreaks = "\"'><=;|&(:"
+)
 
 type options struct {
-	predictors   map[string]complete.Predictor
-	exitFunc     func(code int)
-	errorHandler func(error)
+	predictors     map[string]complete.Predictor
+	typePredictors map[reflect.Type]complete.Predictor
+	exitFunc       func(code int)
+	errorHandler   func(error)
+	hiddenAliases  bool
+	// passthroughPredictor predicts passthrough arguments without a predictor tag
+	passthroughPredictor complete.Predictor
+	contextPredictors    map[string]ContextPredictor
+	// trace is the kong trace of the completion in progress for context predictors
+	trace *trace
+	// completeCommandOnly is true when COMP_LINE is only read for the __complete command
+	completeCommandOnly bool
+	// equalsFlagNames is true when the long names of flags that take values are suggested as "--flag="
+	equalsFlagNames bool
+	// args are the program's arguments, without the program name
+	args []string
+}
+
+// ValuePredictor can be implemented by the type of a flag or positional argument, or by its kong.Mapper, to
+// predict its own values. It is used when the value has no predictor tag and its type has no predictor from
+// WithTypePredictor. The value itself is used, so a type can predict from state set before parsing.
+type ValuePredictor interface {
+	PredictValue(a complete.Args) []string
 }
 
 // Option is a configuration option for running Complete
 type Option func(*options)
 
-// WithPredictor use the named predictor
+// WithPredictor use the named predictor. The predictors named "file" and "dir" are also used for values whose
+// kong type is a file or directory, such as `type:"path"`, `type:"existingdir"` or kong.FileContentFlag.
 func WithPredictor(name string, predictor complete.Predictor) Option {
 	return func(o *options) {
 		if o.predictors == nil {
@@ -29,6 +67,17 @@ func WithPredictor(name string, predictor complete.Predictor) Option {
 	}
 }
 
+// WithTypePredictor use predictor for flags and positional arguments of type typ, or slices of typ, that
+// don't have a predictor tag.
+func WithTypePredictor(typ reflect.Type, predictor complete.Predictor) Option {
+	return func(o *options) {
+		if o.typePredictors == nil {
+			o.typePredictors = map[reflect.Type]complete.Predictor{}
+		}
+		o.typePredictors[typ] = predictor
+	}
+}
+
 // WithPredictors use these predictors
 func WithPredictors(predictors map[string]complete.Predictor) Option {
 	return func(o *options) {
@@ -52,9 +101,48 @@ func WithErrorHandler(handler func(error)) Option {
 	}
 }
 
+// WithHiddenAliases only suggest the canonical names of commands. Aliases are still recognised when typed.
+// This has no effect on the complete.Command returned by Command.
+func WithHiddenAliases() Option {
+	return func(o *options) {
+		o.hiddenAliases = true
+	}
+}
+
+// WithPassthroughPredictor use this predictor for passthrough arguments that don't have a predictor tag. Once
+// a passthrough argument starts, the predictor receives the rest of the line as if it were the whole line, so it
+// can be another command's complete.Command.
+func WithPassthroughPredictor(predictor complete.Predictor) Option {
+	return func(o *options) {
+		o.passthroughPredictor = predictor
+	}
+}
+
+// WithCompleteCommand only complete when the program is run as "app __complete". Without it, COMP_LINE in the
+// environment is enough to run completion, which misfires when another tool sets it. The scripts kongplete
+// generates run __complete, so they work either way.
+func WithCompleteCommand() Option {
+	return func(o *options) {
+		o.completeCommandOnly = true
+	}
+}
+
+// WithEqualsFlagNames suggest the long names of flags that take values with a trailing "=", like "--format=", so
+// the value is typed without a space.
+func WithEqualsFlagNames() Option {
+	return func(o *options) {
+		o.equalsFlagNames = true
+	}
+}
+
 func buildOptions(opt ...Option) *options {
 	opts := &options{
-		predictors: map[string]complete.Predictor{},
+		predictors: map[string]complete.Predictor{
+			filePredictorName: PredictFiles("*"),
+			dirPredictorName:  PredictDirs("*"),
+		},
+		trace: &trace{},
+		args:  os.Args[1:],
 	}
 	for _, o := range opt {
 		o(opts)
@@ -62,20 +150,34 @@ func buildOptions(opt ...Option) *options {
 	return opts
 }
 
-// Command returns a completion Command for a kong parser
+// Command returns a completion Command for a kong parser. Its context predictors trace the args they predict, or
+// COMP_LINE when the args are from it, so the predictors of sub-commands see the flags before them.
 func Command(parser *kong.Kong, opt ...Option) (complete.Command, error) {
 	opts := buildOptions(opt...)
 	if parser == nil || parser.Model == nil {
 		return complete.Command{}, nil
 	}
-	command, err := nodeCommand(parser.Model.Node, opts.predictors)
+	opts.trace.parser = parser
+	cmd, err := nodeCommand(parser.Model.Node, opts)
 	if err != nil {
 		return complete.Command{}, err
 	}
-	return *command, err
+	return cmd.completeCommand(), nil
 }
 
-// Complete runs completion for a kong parser
+// Complete runs completion for a kong parser when the program is run for completion and exits, and does nothing
+// otherwise. There are two ways to run it for completion:
+//
+// The env-based way sets COMP_LINE, and optionally COMP_POINT, to the command line being completed, like bash's
+// "complete -C" does. The candidates are written one per line.
+//
+// The command way runs "app __complete <args...>" where args are the arguments after the program name, and the
+// last one is the argument being completed. Every candidate is written as "value<TAB>description<TAB>group" and
+// the last line is a directive starting with ":". The directive is made of the words "nospace", "nofallback" and
+// "files PATTERN" or "dirs PATTERN" when the shell should complete paths itself, in that order. COMP_LINE is
+// ignored then, so one left in the environment by another tool doesn't get in the way. When KONGPLETE_INLINE_FILES
+// is set, paths are written as candidates rather than a "files" or "dirs" directive for shells that can't complete
+// paths themselves. The scripts kongplete generates use this way.
 func Complete(parser *kong.Kong, opt ...Option) {
 	if parser == nil {
 		return
@@ -91,39 +193,114 @@ func Complete(parser *kong.Kong, opt ...Option) {
 	if exitFunc == nil {
 		exitFunc = parser.Exit
 	}
-	cmd, err := Command(parser, opt...)
+	opts.trace.parser = parser
+	cmd, err := nodeCommand(parser.Model.Node, opts)
 	if err != nil {
 		errHandler(err)
 		exitFunc(1)
+		return
+	}
+	var (
+		a     complete.Args
+		field string
+		rich  bool
+	)
+	line, ok := compLine()
+	switch {
+	case len(opts.args) > 0 && opts.args[0] == completeCmd:
+		complete.Log("Completing args: %q", opts.args[1:])
+		a = newArgsFromWords(opts.args[1:])
+		field = last(opts.args[1:])
+		rich = true
+	case ok && !opts.completeCommandOnly:
+		complete.Log("Completing phrase: %s", line)
+		a = newArgs(line)
+		field = lastField(line)
+	default:
+		return
+	}
+	opts.trace.completed, opts.trace.complete = a.Completed, true
+	complete.Log("Completing last field: %s", a.Last)
+	p, _ := cmd.predict(a)
+
+	options := p.candidates
+	if !rich || os.Getenv(envInlineFiles) != "" {
+		options = p.inlineFiles()
+	}
+	complete.Log("Options: %s", options)
+	// Shells that use the rich format replace the whole field, so candidates for the value of "--flag=value" keep
+	// the flag. Shells that use the plain format only replace the part after the last word break, like bash does,
+	// so candidates like "key=value" are trimmed to it.
+	var prefix string
+	trim := 0
+	if rich {
+		prefix = flagValuePrefix(field)
+	} else {
+		trim = strings.LastIndexAny(a.Last, wordBreaks) + 1
+	}
+	matched, equals := 0, 0
+	for _, option := range options {
+		if !strings.HasPrefix(option.Value, a.Last) {
+			continue
+		}
+		matched++
+		if strings.HasSuffix(option.Value, "=") {
+			equals++
+		}
+		value := prefix + option.Value[trim:]
+		if rich {
+			fmt.Fprintf(parser.Stdout, "%s\t%s\t%s\n", value, oneLine(option.Description), oneLine(option.Group))
+		} else {
+			fmt.Fprintln(parser.Stdout, value)
+		}
+	}
+	// A space after "--flag=" or "key=" would end the value before it is typed.
+	if matched > 0 && matched == equals {
+		p.directives |= DirectiveNoSpace
 	}
-	cmp := complete.New(parser.Model.Name, cmd)
-	cmp.Out = parser.Stdout
-	done := cmp.Complete()
-	if done {
-		exitFunc(0)
+	if rich {
+		fmt.Fprintln(parser.Stdout, ":"+p.directive())
 	}
+	exitFunc(0)
 }
 
-func nodeCommand(node *kong.Node, predictors map[string]complete.Predictor) (*complete.Command, error) {
+func nodeCommand(node *kong.Node, opts *options) (*command, error) {
 	if node == nil {
 		return nil, nil
 	}
 
-	cmd := complete.Command{
-		Sub:         complete.Commands{},
-		GlobalFlags: complete.Flags{},
+	cmd := command{
+		sub:   map[string]*command{},
+		flags: complete.Flags{},
 	}
 
+	children := make([]*kong.Node, 0, len(node.Children))
 	for _, child := range node.Children {
 		if child == nil || child.Hidden {
 			continue
 		}
-		childCmd, err := nodeCommand(child, predictors)
+		childCmd, err := nodeCommand(child, opts)
 		if err != nil {
 			return nil, err
 		}
 		if childCmd != nil {
-			cmd.Sub[child.Name] = *childCmd
+			childCmd.parent = &cmd
+			cmd.sub[child.Name] = childCmd
+			cmd.subNames = append(cmd.subNames, Candidate{Value: child.Name, Description: child.Help, Group: commandGroup(child)})
+			children = append(children, child)
+		}
+	}
+
+	// Like kong, ignore aliases that collide with a command name.
+	for _, child := range children {
+		for _, alias := range child.Aliases {
+			if _, ok := cmd.sub[alias]; ok {
+				continue
+			}
+			cmd.sub[alias] = cmd.sub[child.Name]
+			if !opts.hiddenAliases {
+				cmd.subNames = append(cmd.subNames, Candidate{Value: alias, Description: child.Help, Group: commandGroup(child)})
+			}
 		}
 	}
 
@@ -131,35 +308,83 @@ func nodeCommand(node *kong.Node, predictors map[string]complete.Predictor) (*co
 		if flag == nil || flag.Hidden {
 			continue
 		}
-		predictor, err := flagPredictor(flag, predictors)
+		predictor, err := flagPredictor(flag, opts)
 		if err != nil {
 			return nil, err
 		}
+		equals := opts.equalsFlagNames && !flag.Value.IsBool() && !flag.Value.IsCounter()
 		for _, f := range flagNamesWithHyphens(flag) {
-			cmd.GlobalFlags[f] = predictor
+			cmd.flags[f] = predictor
+			name := f
+			if equals && strings.HasPrefix(f, "--") {
+				name += "="
+			}
+			cmd.flagNames = append(cmd.flagNames, Candidate{Value: name, Description: flag.Help, Group: flagGroup(flag)})
 		}
 	}
 
-	boolFlags, nonBoolFlags := boolAndNonBoolFlags(node.Flags)
+	// Flags from ancestors can be interleaved with positional arguments, so count them too.
+	boolFlags, nonBoolFlags := boolAndNonBoolFlags(scopeFlags(node))
 	isCumulative := false
-	if len(node.Positional) > 0 && node.Positional[len(node.Positional)-1].IsCumulative() {
-		isCumulative = true
+	isPassthrough := node.Passthrough
+	if len(node.Positional) > 0 {
+		lastArg := node.Positional[len(node.Positional)-1]
+		isCumulative = lastArg.IsCumulative()
+		isPassthrough = isPassthrough || lastArg.Passthrough
 	}
 
-	pps, err := positionalPredictors(node.Positional, predictors)
+	pps, err := positionalPredictors(node, opts)
 	if err != nil {
 		return nil, err
 	}
-	cmd.Args = &positionalpredictor.PositionalPredictor{
+	cmd.args = &positionalpredictor.PositionalPredictor{
 		Predictors:   pps,
-		ArgFlags:     flagNamesWithHyphens(nonBoolFlags...),
-		BoolFlags:    flagNamesWithHyphens(boolFlags...),
 		IsCumulative: isCumulative,
+		Passthrough:  isPassthrough,
+	}
+	// Kong doesn't parse any flags after a passthrough command.
+	cmd.passthrough = node.Passthrough
+	if !cmd.passthrough {
+		cmd.args.ArgFlags = flagNamesWithHyphens(nonBoolFlags...)
+		cmd.args.BoolFlags = flagNamesWithHyphens(boolFlags...)
 	}
 
 	return &cmd, nil
 }
 
+// commandGroup returns the group title kong's help shows a command under.
+func commandGroup(node *kong.Node) string {
+	if node.Group != nil {
+		return node.Group.Title
+	}
+	return "Commands"
+}
+
+// flagGroup returns the group title kong's help shows a flag under.
+func flagGroup(flag *kong.Flag) string {
+	if flag.Group != nil {
+		return flag.Group.Title
+	}
+	return "Flags"
+}
+
+// oneLine replaces line breaks and tabs in s with spaces so it fits on one line of completion output.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// scopeFlags returns the flags kong accepts after node: its own flags (including embedded and help flags)
+// and those of its ancestors. Hidden flags are included because they may still be typed.
+func scopeFlags(node *kong.Node) []*kong.Flag {
+	var flags []*kong.Flag
+	for n := node; n != nil; n = n.Parent {
+		flags = append(flags, n.Flags...)
+	}
+	return flags
+}
+
+// flagNamesWithHyphens returns every spelling kong accepts for the flags: long and short names, aliases
+// and the --no- form of negatable flags.
 func flagNamesWithHyphens(flags ...*kong.Flag) []string {
 	names := make([]string, 0, len(flags)*2)
 	if flags == nil {
@@ -170,6 +395,12 @@ func flagNamesWithHyphens(flags ...*kong.Flag) []string {
 		if flag.Short != 0 {
 			names = append(names, "-"+string(flag.Short))
 		}
+		for _, alias := range flag.Aliases {
+			names = append(names, "--"+alias)
+		}
+		if flag.Tag.Negatable {
+			names = append(names, "--no-"+flag.Name)
+		}
 	}
 	return names
 }
@@ -195,54 +426,219 @@ type kongTag interface {
 	Get(string) string
 }
 
-func tagPredictor(tag kongTag, predictors map[string]complete.Predictor) (complete.Predictor, error) {
+func tagPredictor(tag kongTag, opts *options) (complete.Predictor, error) {
 	if tag == nil {
 		return nil, nil
 	}
 	if !tag.Has(predictorTag) {
 		return nil, nil
 	}
-	if predictors == nil {
-		predictors = map[string]complete.Predictor{}
-	}
-	predictorName := tag.Get(predictorTag)
-	predictor, ok := predictors[predictorName]
-	if !ok {
-		return nil, fmt.Errorf("no predictor with name %q", predictorName)
-	}
-	return predictor, nil
+	return namedPredictor(tag.Get(predictorTag), opts)
 }
 
-func valuePredictor(value *kong.Value, predictors map[string]complete.Predictor) (complete.Predictor, error) {
+// valuePredictor returns the predictor for a value. In order of precedence that is the predictor from its
+// predictor tag, the predictors from its predictor-key and predictor-value tags, the predictor registered for its
+// type, its type or mapper if either is a ValuePredictor, a file or directory predictor inferred from its type or a
+// predictor based on its enum or bool-ness.
+func valuePredictor(value *kong.Value, opts *options) (complete.Predictor, error) {
 	if value == nil {
 		return nil, nil
 	}
-	predictor, err := tagPredictor(value.Tag, predictors)
+	predictor, err := tagPredictor(value.Tag, opts)
+	if err != nil {
+		return nil, err
+	}
+	if predictor != nil {
+		return predictor, nil
+	}
+	predictor, err = mapTagPredictor(value, opts)
 	if err != nil {
 		return nil, err
 	}
 	if predictor != nil {
 		return predictor, nil
 	}
+	if predictor, ok := typePredictor(value, opts.typePredictors); ok {
+		return predictor, nil
+	}
+	if predictor, ok := valueTypePredictor(value); ok {
+		return predictor, nil
+	}
+	if name := inferredPredictorName(value); name != "" {
+		if predictor, ok := opts.predictors[name]; ok {
+			return predictor, nil
+		}
+	}
 	switch {
 	case value.IsBool():
 		return complete.PredictNothing, nil
 	case value.Enum != "":
-		enumVals := make([]string, 0, len(value.EnumMap()))
-		for enumVal := range value.EnumMap() {
-			enumVals = append(enumVals, enumVal)
+		enumVals := value.EnumSlice()
+		candidates := make([]Candidate, len(enumVals))
+		for i, enumVal := range enumVals {
+			candidates[i] = Candidate{Value: enumVal}
+		}
+		return PredictCandidates(candidates...), nil
+	default:
+		// Values that can be anything have no candidates. Unlike complete.PredictAnything, static scripts can
+		// tell.
+		return PredictCandidates(), nil
+	}
+}
+
+// mapTagPredictor returns a predictor for the keys and values of a map from its predictor-key and predictor-value
+// tags, or nil when it has neither.
+func mapTagPredictor(value *kong.Value, opts *options) (complete.Predictor, error) {
+	if value.Tag == nil || !value.Tag.Has(keyPredictorTag) && !value.Tag.Has(valuePredictorTag) {
+		return nil, nil
+	}
+	if !value.IsMap() {
+		return nil, fmt.Errorf("%s and %s tags are only supported for maps", keyPredictorTag, valuePredictorTag)
+	}
+	var (
+		p   mapPredictor
+		err error
+	)
+	if value.Tag.Has(keyPredictorTag) {
+		p.key, err = namedPredictor(value.Tag.Get(keyPredictorTag), opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if value.Tag.Has(valuePredictorTag) {
+		p.value, err = namedPredictor(value.Tag.Get(valuePredictorTag), opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+// namedPredictor returns the context predictor or predictor with the given name.
+func namedPredictor(name string, opts *options) (complete.Predictor, error) {
+	if predictor, ok := opts.contextPredictors[name]; ok {
+		return &contextPredictor{predictor: predictor, trace: opts.trace}, nil
+	}
+	predictor, ok := opts.predictors[name]
+	if !ok {
+		return nil, fmt.Errorf("no predictor with name %q", name)
+	}
+	return predictor, nil
+}
+
+// typePredictor returns the predictor registered for the value's type or, for slices, its element type.
+func typePredictor(value *kong.Value, typePredictors map[reflect.Type]complete.Predictor) (complete.Predictor, bool) {
+	if len(typePredictors) == 0 || !value.Target.IsValid() {
+		return nil, false
+	}
+	typ := value.Target.Type()
+	if predictor, ok := typePredictors[typ]; ok {
+		return predictor, true
+	}
+	if value.IsSlice() {
+		predictor, ok := typePredictors[typ.Elem()]
+		return predictor, ok
+	}
+	return nil, false
+}
+
+// valueTypePredictor returns a predictor for a value whose mapper, type or, for slices and maps, element types
+// implement ValuePredictor. The value's target is checked, so a type can predict from its state, such as values set
+// on the CLI struct before parsing. Nil pointers and the elements of slices and maps are checked with a new zero
+// value.
+func valueTypePredictor(value *kong.Value) (complete.Predictor, bool) {
+	if vp, ok := value.Mapper.(ValuePredictor); ok {
+		return complete.PredictFunc(vp.PredictValue), true
+	}
+	if !value.Target.IsValid() {
+		return nil, false
+	}
+	target := value.Target
+	switch {
+	case value.IsSlice():
+		return zeroValuePredictor(target.Type().Elem())
+	case value.IsMap():
+		var p mapPredictor
+		p.key, _ = zeroValuePredictor(target.Type().Key())
+		p.value, _ = zeroValuePredictor(target.Type().Elem())
+		return &p, p.key != nil || p.value != nil
+	case target.Kind() == reflect.Ptr:
+		if target.IsNil() {
+			return zeroValuePredictor(target.Type())
 		}
-		return complete.PredictSet(enumVals...), nil
+	case target.CanAddr():
+		target = target.Addr()
 	default:
-		return complete.PredictAnything, nil
+		return zeroValuePredictor(target.Type())
 	}
+	if vp, ok := target.Interface().(ValuePredictor); ok {
+		return complete.PredictFunc(vp.PredictValue), true
+	}
+	return nil, false
+}
+
+// zeroValuePredictor returns a predictor for typ when a new zero value of it implements ValuePredictor.
+func zeroValuePredictor(typ reflect.Type) (complete.Predictor, bool) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if vp, ok := reflect.New(typ).Interface().(ValuePredictor); ok {
+		return complete.PredictFunc(vp.PredictValue), true
+	}
+	return nil, false
 }
 
-func positionalPredictors(args []*kong.Positional, predictors map[string]complete.Predictor) ([]complete.Predictor, error) {
-	res := make([]complete.Predictor, len(args))
+var (
+	fileTypes = map[reflect.Type]bool{
+		reflect.TypeOf((*os.File)(nil)):             true,
+		reflect.TypeOf(kong.FileContentFlag{}):      true,
+		reflect.TypeOf(kong.NamedFileContentFlag{}): true,
+		reflect.TypeOf(kong.ConfigFlag("")):         true,
+	}
+	dirTypes = map[reflect.Type]bool{
+		reflect.TypeOf(kong.ChangeDirFlag("")): true,
+	}
+)
+
+// inferredPredictorName returns the name of the predictor to use for a value based on its kong type tag or
+// its type. It returns "" when the value isn't a file or directory.
+func inferredPredictorName(value *kong.Value) string {
+	if value.Tag != nil {
+		switch value.Tag.Type {
+		case "path", "existingfile", "filecontent":
+			return filePredictorName
+		case "existingdir":
+			return dirPredictorName
+		}
+	}
+	if !value.Target.IsValid() {
+		return ""
+	}
+	typ := value.Target.Type()
+	if value.IsSlice() {
+		typ = typ.Elem()
+	}
+	switch {
+	case fileTypes[typ]:
+		return filePredictorName
+	case dirTypes[typ]:
+		return dirPredictorName
+	default:
+		return ""
+	}
+}
+
+func positionalPredictors(node *kong.Node, opts *options) ([]complete.Predictor, error) {
+	res := make([]complete.Predictor, len(node.Positional))
 	var err error
-	for i, arg := range args {
-		res[i], err = valuePredictor(arg, predictors)
+	for i, arg := range node.Positional {
+		// the only argument of a passthrough command is a passthrough argument
+		isPassthrough := arg.Passthrough || node.Passthrough
+		if isPassthrough && opts.passthroughPredictor != nil && !arg.Tag.Has(predictorTag) {
+			res[i] = opts.passthroughPredictor
+			continue
+		}
+		res[i], err = valuePredictor(arg, opts)
 		if err != nil {
 			return nil, err
 		}
@@ -250,6 +646,11 @@ func positionalPredictors(args []*kong.Positional, predictors map[string]complet
 	return res, nil
 }
 
-func flagPredictor(flag *kong.Flag, predictors map[string]complete.Predictor) (complete.Predictor, error) {
-	return valuePredictor(flag.Value, predictors)
+// flagPredictor returns the predictor for a flag's value. Slice and map values are predicted element by element.
+func flagPredictor(flag *kong.Flag, opts *options) (complete.Predictor, error) {
+	predictor, err := valuePredictor(flag.Value, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newElementsPredictor(flag.Value, predictor), nil
 }
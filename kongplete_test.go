@@ -3,9 +3,12 @@ package kongplete
 import (
 	"bytes"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/posener/complete"
@@ -13,11 +16,6 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-const (
-	envLine  = "COMP_LINE"
-	envPoint = "COMP_POINT"
-)
-
 func TestComplete(t *testing.T) {
 	type embed struct {
 		Lion string
@@ -160,6 +158,1205 @@ func TestComplete(t *testing.T) {
 	}
 }
 
+func TestComplete_aliases(t *testing.T) {
+	predictors := map[string]complete.Predictor{
+		"things": complete.PredictSet("thing1", "thing2"),
+	}
+
+	var cli struct {
+		Remove struct {
+			Force bool   `kong:"short=f"`
+			Path  string `kong:"arg,predictor=things"`
+		} `kong:"cmd,aliases='rm,del'"`
+		List struct{} `kong:"cmd,aliases='ls,remove'"`
+	}
+
+	for _, td := range []struct {
+		completeTest
+		options []Option
+	}{
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"remove", "rm", "del", "list", "ls"},
+				line:   "myApp ",
+			},
+		},
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"thing1", "thing2"},
+				line:   "myApp rm ",
+			},
+		},
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"--force", "-f", "--help", "-h"},
+				line:   "myApp del -",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name:   "hidden aliases",
+				parser: kong.Must(&cli),
+				want:   []string{"remove", "list"},
+				line:   "myApp ",
+			},
+			options: []Option{WithHiddenAliases()},
+		},
+		{
+			completeTest: completeTest{
+				name:   "hidden aliases are recognised",
+				parser: kong.Must(&cli),
+				want:   []string{"thing1", "thing2"},
+				line:   "myApp del -f ",
+			},
+			options: []Option{WithHiddenAliases()},
+		},
+	} {
+		name := td.name
+		if name == "" {
+			name = td.line
+		}
+		t.Run(name, func(t *testing.T) {
+			options := append([]Option{WithPredictors(predictors)}, td.options...)
+			got := runComplete(t, td.parser, td.line, options)
+			assert.ElementsMatch(t, td.want, got)
+		})
+	}
+
+	t.Run("Command", func(t *testing.T) {
+		cmd, err := Command(kong.Must(&cli), WithPredictors(predictors))
+		require.NoError(t, err)
+		assert.Contains(t, cmd.Sub, "del")
+		assert.Equal(t, cmd.Sub["remove"].Args, cmd.Sub["del"].Args)
+	})
+}
+
+func TestComplete_flagAliases(t *testing.T) {
+	predictors := map[string]complete.Predictor{
+		"things":      complete.PredictSet("thing1", "thing2"),
+		"otherthings": complete.PredictSet("otherthing1", "otherthing2"),
+	}
+
+	var cli struct {
+		Color  bool   `kong:"negatable"`
+		Output string `kong:"aliases='out,o2',predictor=things"`
+		Tiger  string `kong:"arg,predictor=things"`
+		Bear   string `kong:"arg,predictor=otherthings"`
+	}
+
+	for _, td := range []completeTest{
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"--color", "--no-color", "--output", "--out", "--o2", "--help", "-h"},
+			line:   "myApp -",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"--no-color"},
+			line:   "myApp --no-",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"thing1", "thing2"},
+			line:   "myApp --out ",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"otherthing1", "otherthing2"},
+			line:   "myApp --o2 thing1 thing2 ",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"otherthing1", "otherthing2"},
+			line:   "myApp --no-color thing1 ",
+		},
+	} {
+		t.Run(td.line, func(t *testing.T) {
+			options := []Option{WithPredictors(predictors)}
+			got := runComplete(t, td.parser, td.line, options)
+			assert.ElementsMatch(t, td.want, got)
+		})
+	}
+}
+
+func TestComplete_parentFlags(t *testing.T) {
+	predictors := map[string]complete.Predictor{
+		"things":      complete.PredictSet("thing1", "thing2"),
+		"otherthings": complete.PredictSet("otherthing1", "otherthing2"),
+	}
+
+	var cli struct {
+		Config  string `kong:"short=c"`
+		Verbose bool   `kong:"short=v"`
+		Secret  string `kong:"hidden"`
+		Sub     struct {
+			Tiger string `kong:"arg,predictor=things"`
+			Bear  string `kong:"arg,predictor=otherthings"`
+		} `kong:"cmd"`
+	}
+
+	for _, td := range []completeTest{
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"thing1", "thing2"},
+			line:   "myApp sub --config foo ",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"thing1", "thing2"},
+			line:   "myApp sub -v -c foo ",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"otherthing1", "otherthing2"},
+			line:   "myApp sub thing1 -c foo ",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"otherthing1", "otherthing2"},
+			line:   "myApp sub --secret foo thing1 ",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"otherthing1", "otherthing2"},
+			line:   "myApp sub --help thing1 ",
+		},
+	} {
+		t.Run(td.line, func(t *testing.T) {
+			options := []Option{WithPredictors(predictors)}
+			got := runComplete(t, td.parser, td.line, options)
+			assert.ElementsMatch(t, td.want, got)
+		})
+	}
+}
+
+func TestComplete_shortFlagClusters(t *testing.T) {
+	predictors := map[string]complete.Predictor{
+		"users": complete.PredictSet("root", "admin"),
+		"files": complete.PredictSet("file1", "file2"),
+	}
+
+	var cli struct {
+		Verbose bool `kong:"short=v"`
+		Rm      struct {
+			User      string   `kong:"short=u,predictor=users"`
+			Force     bool     `kong:"short=f"`
+			Recursive bool     `kong:"short=r"`
+			Paths     []string `kong:"arg,predictor=files"`
+		} `kong:"cmd"`
+	}
+
+	for _, td := range []completeTest{
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"file1", "file2"},
+			line:   "myApp rm -rf ",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"file1", "file2"},
+			line:   "myApp rm -uroot ",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"root", "admin"},
+			line:   "myApp rm -rfu ",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"root", "admin"},
+			line:   "myApp rm -vu ",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"-u", "-uroot", "-uadmin"},
+			line:   "myApp rm -u",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"-rfuroot"},
+			line:   "myApp rm -rfur",
+		},
+		{
+			parser: kong.Must(&cli),
+			want:   []string{"file1", "file2"},
+			line:   "myApp rm -rfu root ",
+		},
+	} {
+		t.Run(td.line, func(t *testing.T) {
+			options := []Option{WithPredictors(predictors)}
+			got := runComplete(t, td.parser, td.line, options)
+			assert.ElementsMatch(t, td.want, got)
+		})
+	}
+}
+
+func TestComplete_endOfFlags(t *testing.T) {
+	predictors := map[string]complete.Predictor{
+		"files":   complete.PredictSet("-file1", "file2"),
+		"things":  complete.PredictSet("thing1", "thing2"),
+		"command": complete.PredictSet("ls", "-l", "-a"),
+	}
+
+	var cli struct {
+		Verbose bool `kong:"short=v"`
+		Rm      struct {
+			Force bool     `kong:"short=f"`
+			User  string   `kong:"predictor=things"`
+			Paths []string `kong:"arg,predictor=files"`
+		} `kong:"cmd"`
+		Run struct {
+			Force bool     `kong:"short=f"`
+			Name  string   `kong:"arg,predictor=things"`
+			Args  []string `kong:"arg,passthrough,predictor=command"`
+		} `kong:"cmd"`
+		Exec struct {
+			Args []string `kong:"arg"`
+		} `kong:"cmd,passthrough"`
+	}
+
+	for _, td := range []struct {
+		completeTest
+		options []Option
+	}{
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"-file1", "--force", "-f", "--user", "--verbose", "-v", "--help", "-h"},
+				line:   "myApp rm -",
+			},
+		},
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"-file1"},
+				line:   "myApp rm -- -",
+			},
+		},
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"-file1", "file2"},
+				line:   "myApp rm -- --user ",
+			},
+		},
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"-l", "-a", "--force", "-f", "--verbose", "-v", "--help", "-h"},
+				line:   "myApp run thing1 -",
+			},
+		},
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"-l", "-a"},
+				line:   "myApp run thing1 ls -",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name:   "passthrough predictor",
+				parser: kong.Must(&cli),
+				want:   []string{"-l", "-a"},
+				line:   "myApp exec ls -",
+			},
+			options: []Option{WithPassthroughPredictor(complete.PredictSet("ls", "-l", "-a"))},
+		},
+		{
+			completeTest: completeTest{
+				name:   "passthrough command",
+				parser: kong.Must(&cli),
+				want:   []string{"-l", "-a"},
+				line:   "myApp exec -",
+			},
+			options: []Option{WithPassthroughPredictor(complete.PredictSet("ls", "-l", "-a"))},
+		},
+		{
+			completeTest: completeTest{
+				name:   "passthrough predictor receives the rest of the line",
+				parser: kong.Must(&cli),
+				want:   []string{"-lah"},
+				line:   "myApp exec ls -",
+			},
+			options: []Option{WithPassthroughPredictor(complete.PredictFunc(func(a complete.Args) []string {
+				if a.LastCompleted != "ls" {
+					return nil
+				}
+				return []string{"-lah"}
+			}))},
+		},
+	} {
+		name := td.name
+		if name == "" {
+			name = td.line
+		}
+		t.Run(name, func(t *testing.T) {
+			options := append([]Option{WithPredictors(predictors)}, td.options...)
+			got := runComplete(t, td.parser, td.line, options)
+			assert.ElementsMatch(t, td.want, got)
+		})
+	}
+}
+
+func TestComplete_inferredPredictors(t *testing.T) {
+	predictors := map[string]complete.Predictor{
+		"file":   complete.PredictSet("file1", "file2"),
+		"dir":    complete.PredictSet("dir1/", "dir2/"),
+		"things": complete.PredictSet("thing1", "thing2"),
+	}
+
+	var cli struct {
+		Path         string                    `kong:"type=path"`
+		ExistingFile string                    `kong:"type=existingfile"`
+		ExistingDir  string                    `kong:"type=existingdir"`
+		Tagged       string                    `kong:"type=path,predictor=things"`
+		File         *os.File                  `kong:""`
+		Content      kong.FileContentFlag      `kong:""`
+		NamedContent kong.NamedFileContentFlag `kong:""`
+		Config       kong.ConfigFlag           `kong:""`
+		Chdir        kong.ChangeDirFlag        `kong:""`
+		Paths        []string                  `kong:"arg,type=path"`
+	}
+
+	for _, td := range []completeTest{
+		{parser: kong.Must(&cli), want: []string{"file1", "file2"}, line: "myApp --path "},
+		{parser: kong.Must(&cli), want: []string{"file1", "file2"}, line: "myApp --existing-file "},
+		{parser: kong.Must(&cli), want: []string{"dir1/", "dir2/"}, line: "myApp --existing-dir "},
+		{parser: kong.Must(&cli), want: []string{"thing1", "thing2"}, line: "myApp --tagged "},
+		{parser: kong.Must(&cli), want: []string{"file1", "file2"}, line: "myApp --file "},
+		{parser: kong.Must(&cli), want: []string{"file1", "file2"}, line: "myApp --content "},
+		{parser: kong.Must(&cli), want: []string{"file1", "file2"}, line: "myApp --named-content "},
+		{parser: kong.Must(&cli), want: []string{"file1", "file2"}, line: "myApp --config "},
+		{parser: kong.Must(&cli), want: []string{"dir1/", "dir2/"}, line: "myApp --chdir "},
+		{parser: kong.Must(&cli), want: []string{"file1", "file2"}, line: "myApp file1 "},
+	} {
+		t.Run(td.line, func(t *testing.T) {
+			options := []Option{WithPredictors(predictors)}
+			got := runComplete(t, td.parser, td.line, options)
+			assert.ElementsMatch(t, td.want, got)
+		})
+	}
+
+	t.Run("default predictors", func(t *testing.T) {
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0o750))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "file.txt"), nil, 0o600))
+		pathPrefix := dir + string(filepath.Separator)
+
+		options := []Option{WithPredictor("things", complete.PredictAnything)}
+		got := runComplete(t, kong.Must(&cli), "myApp --path "+pathPrefix, options)
+		assert.ElementsMatch(t, []string{pathPrefix, pathPrefix + "subdir/", pathPrefix + "file.txt"}, got)
+
+		got = runComplete(t, kong.Must(&cli), "myApp --existing-dir "+pathPrefix, options)
+		assert.ElementsMatch(t, []string{pathPrefix, pathPrefix + "subdir/"}, got)
+	})
+}
+
+type testRegion string
+
+func TestComplete_typePredictors(t *testing.T) {
+	predictors := map[string]complete.Predictor{
+		"things": complete.PredictSet("thing1", "thing2"),
+	}
+
+	var cli struct {
+		Region   testRegion    `kong:""`
+		Regions  []testRegion  `kong:""`
+		Timeout  time.Duration `kong:""`
+		Tagged   testRegion    `kong:"predictor=things"`
+		Enum     testRegion    `kong:"enum='a,b',default=a"`
+		File     *os.File      `kong:""`
+		Other    string        `kong:""`
+		Position testRegion    `kong:"arg"`
+	}
+
+	for _, td := range []completeTest{
+		{parser: kong.Must(&cli), want: []string{"us-east", "eu-west"}, line: "myApp --region "},
+		{parser: kong.Must(&cli), want: []string{"us-east", "eu-west"}, line: "myApp --regions "},
+		{parser: kong.Must(&cli), want: []string{"1s", "1m"}, line: "myApp --timeout "},
+		{parser: kong.Must(&cli), want: []string{"thing1", "thing2"}, line: "myApp --tagged "},
+		{parser: kong.Must(&cli), want: []string{"us-east", "eu-west"}, line: "myApp --enum "},
+		{parser: kong.Must(&cli), want: []string{"file.yaml"}, line: "myApp --file "},
+		{parser: kong.Must(&cli), want: []string{}, line: "myApp --other "},
+		{parser: kong.Must(&cli), want: []string{"us-east", "eu-west"}, line: "myApp "},
+	} {
+		t.Run(td.line, func(t *testing.T) {
+			options := []Option{
+				WithPredictors(predictors),
+				WithTypePredictor(reflect.TypeOf(testRegion("")), complete.PredictSet("us-east", "eu-west")),
+				WithTypePredictor(reflect.TypeOf(time.Duration(0)), complete.PredictSet("1s", "1m")),
+				WithTypePredictor(reflect.TypeOf(&os.File{}), complete.PredictSet("file.yaml")),
+			}
+			got := runComplete(t, td.parser, td.line, options)
+			assert.ElementsMatch(t, td.want, got)
+		})
+	}
+}
+
+type testColor string
+
+func (testColor) PredictValue(complete.Args) []string {
+	return []string{"red", "green"}
+}
+
+type testSizeMapper struct{}
+
+func (testSizeMapper) Decode(ctx *kong.DecodeContext, target reflect.Value) error {
+	return ctx.Scan.PopValueInto("size", target.Addr().Interface())
+}
+
+func (testSizeMapper) PredictValue(complete.Args) []string {
+	return []string{"small", "large"}
+}
+
+// testChoice is a value that predicts the choices set on it before parsing.
+type testChoice struct {
+	value   string
+	choices []string
+}
+
+func (c *testChoice) Decode(ctx *kong.DecodeContext) error {
+	return ctx.Scan.PopValueInto("choice", &c.value)
+}
+
+func (c *testChoice) PredictValue(complete.Args) []string {
+	return c.choices
+}
+
+func TestComplete_valuePredictors(t *testing.T) {
+	predictors := map[string]complete.Predictor{
+		"things": complete.PredictSet("thing1", "thing2"),
+	}
+
+	var cli struct {
+		Color     testColor            `kong:""`
+		ColorPtr  *testColor           `kong:""`
+		Colors    []testColor          `kong:""`
+		Tagged    testColor            `kong:"predictor=things"`
+		Size      string               `kong:"type=size"`
+		Palette   map[string]testColor `kong:""`
+		Choice    testChoice           `kong:""`
+		ChoicePtr *testChoice          `kong:""`
+		Position  []*testColor         `kong:"arg"`
+	}
+	newParser := func() *kong.Kong {
+		cli.Choice = testChoice{choices: []string{"a", "b"}}
+		cli.ChoicePtr = &testChoice{choices: []string{"c", "d"}}
+		return kong.Must(&cli, kong.NamedMapper("size", testSizeMapper{}))
+	}
+
+	for _, td := range []completeTest{
+		{parser: newParser(), want: []string{"red", "green"}, line: "myApp --color "},
+		{parser: newParser(), want: []string{"red", "green"}, line: "myApp --color-ptr "},
+		{parser: newParser(), want: []string{"red", "green"}, line: "myApp --colors "},
+		{parser: newParser(), want: []string{"thing1", "thing2"}, line: "myApp --tagged "},
+		{parser: newParser(), want: []string{"small", "large"}, line: "myApp --size "},
+		{parser: newParser(), want: []string{"red", "green"}, line: "myApp --palette bg="},
+		{parser: newParser(), want: []string{"a", "b"}, line: "myApp --choice "},
+		{parser: newParser(), want: []string{"c", "d"}, line: "myApp --choice-ptr "},
+		{parser: newParser(), want: []string{"red", "green"}, line: "myApp red "},
+	} {
+		t.Run(td.line, func(t *testing.T) {
+			options := []Option{WithPredictors(predictors)}
+			got := runComplete(t, td.parser, td.line, options)
+			assert.ElementsMatch(t, td.want, got)
+		})
+	}
+}
+
+func TestComplete_descriptions(t *testing.T) {
+	predictors := map[string]complete.Predictor{
+		"formats": PredictCandidates(
+			Candidate{Value: "json", Description: "JSON output"},
+			Candidate{Value: "text"},
+		),
+	}
+
+	var cli struct {
+		Format string `kong:"short=f,predictor=formats,help='Output format.'"`
+		Get    struct {
+			Verbose bool `kong:"help='Be\nloud.'"`
+		} `kong:"cmd,aliases=g,help='Get things.'"`
+		Put struct{} `kong:"cmd"`
+	}
+
+	for _, td := range []struct {
+		completeTest
+		rich bool
+	}{
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"get", "g", "put"},
+				line:   "myApp ",
+			},
+		},
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"get\tGet things.\tCommands", "g\tGet things.\tCommands", "put\t\tCommands", ":"},
+				line:   "myApp ",
+			},
+			rich: true,
+		},
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want: []string{
+					"--format\tOutput format.\tFlags", "-f\tOutput format.\tFlags",
+					"--help\tShow context-sensitive help.\tFlags", "-h\tShow context-sensitive help.\tFlags", ":",
+				},
+				line: "myApp -",
+			},
+			rich: true,
+		},
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"--verbose\tBe loud.\tFlags", ":"},
+				line:   "myApp get --v",
+			},
+			rich: true,
+		},
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"json\tJSON output\t", "text\t\t", ":"},
+				line:   "myApp --format ",
+			},
+			rich: true,
+		},
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"-fjson\tJSON output\t", ":"},
+				line:   "myApp -fj",
+			},
+			rich: true,
+		},
+		{
+			completeTest: completeTest{
+				parser: kong.Must(&cli),
+				want:   []string{"json", "text"},
+				line:   "myApp --format ",
+			},
+		},
+	} {
+		name := td.line
+		if td.rich {
+			name += " rich"
+		}
+		t.Run(name, func(t *testing.T) {
+			options := []Option{WithPredictors(predictors)}
+			run := runComplete
+			if td.rich {
+				run = runCompleteArgs
+			}
+			got := run(t, td.parser, td.line, options)
+			assert.ElementsMatch(t, td.want, got)
+		})
+	}
+}
+
+func TestComplete_rich(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0o600))
+
+	var cli struct {
+		Format string `kong:"help='Output format.',group='Output',enum='json,text',default='text'"`
+		Config string `kong:"type='path'"`
+		Cd     string `kong:"type='existingdir'"`
+		Get    struct {
+			Path string `kong:"arg,type='path'"`
+		} `kong:"cmd,help='Get things.',group='Read'"`
+		Put struct{} `kong:"cmd"`
+	}
+
+	for _, td := range []completeTest{
+		{
+			name: "commands",
+			want: []string{"get\tGet things.\tRead", "put\t\tCommands", ":"},
+			line: "myApp ",
+		},
+		{
+			name: "flags",
+			want: []string{
+				"--help\tShow context-sensitive help.\tFlags",
+				"-h\tShow context-sensitive help.\tFlags",
+				"--format\tOutput format.\tOutput",
+				"--config\t\tFlags",
+				"--cd\t\tFlags",
+				":",
+			},
+			line: "myApp -",
+		},
+		{
+			name: "values",
+			want: []string{"json\t\t", ":"},
+			line: "myApp --format j",
+		},
+		{
+			name: "files",
+			want: []string{":files *"},
+			line: "myApp --config " + dir + "/",
+		},
+		{
+			name: "dirs",
+			want: []string{":dirs *"},
+			line: "myApp --cd ",
+		},
+		{
+			name: "positional files",
+			want: []string{":files *"},
+			line: "myApp get ",
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			got := runCompleteArgs(t, kong.Must(&cli), td.line, nil)
+			assert.Equal(t, td.want, got)
+		})
+	}
+
+	t.Run("files without rich format", func(t *testing.T) {
+		got := runComplete(t, kong.Must(&cli), "myApp --config "+dir+"/", nil)
+		assert.ElementsMatch(t, []string{dir + "/", filepath.Join(dir, "a.txt")}, got)
+	})
+
+	t.Run("inline files", func(t *testing.T) {
+		t.Setenv(envInlineFiles, "1")
+		got := runCompleteArgs(t, kong.Must(&cli), "myApp --config "+dir+"/", nil)
+		assert.ElementsMatch(t, []string{dir + "/\t\t", filepath.Join(dir, "a.txt") + "\t\t", ":"}, got)
+		got = runCompleteArgs(t, kong.Must(&cli), "myApp --cd ", nil)
+		assert.NotContains(t, got, ":dirs *")
+	})
+}
+
+type argsDirectivePredictor struct{}
+
+func (argsDirectivePredictor) Predict(complete.Args) []string {
+	return []string{"key="}
+}
+
+func (argsDirectivePredictor) PredictDirective(a complete.Args) Directive {
+	if a.Last == "" {
+		return DirectiveNoFallback
+	}
+	return DirectiveNoSpace
+}
+
+func TestComplete_directives(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), nil, 0o600))
+
+	var cli struct {
+		Dir      string `predictor:"nospace"`
+		Nothing  string `predictor:"nofallback"`
+		Fallback string `predictor:"fallback"`
+		Out      string `predictor:"dirs"`
+		Key      string `predictor:"args"`
+	}
+	options := []Option{
+		WithPredictor("nospace", PredictWithDirective(complete.PredictSet("a/", "b/"), DirectiveNoSpace)),
+		WithPredictor("nofallback", PredictWithDirective(nil, DirectiveNoFallback)),
+		WithPredictor("fallback", PredictWithDirective(complete.PredictSet("x"), DirectiveFiles)),
+		WithPredictor("dirs", PredictWithDirective(PredictDirs("*"), DirectiveNoSpace)),
+		WithPredictor("args", argsDirectivePredictor{}),
+	}
+
+	for _, td := range []completeTest{
+		{
+			name: "nospace",
+			want: []string{"a/\t\t", "b/\t\t", ":nospace"},
+			line: "myApp --dir ",
+		},
+		{
+			name: "nofallback",
+			want: []string{":nofallback"},
+			line: "myApp --nothing ",
+		},
+		{
+			name: "files",
+			want: []string{"x\t\t", ":files *"},
+			line: "myApp --fallback ",
+		},
+		{
+			name: "dirs",
+			want: []string{":nospace dirs *"},
+			line: "myApp --out ",
+		},
+		{
+			name: "directive predictor",
+			want: []string{"key=\t\t", ":nospace"},
+			line: "myApp --key k",
+		},
+		{
+			name: "directive predictor args",
+			want: []string{"key=\t\t", ":nospace nofallback"},
+			line: "myApp --key ",
+		},
+		{
+			name: "no directive",
+			want: []string{":"},
+			line: "myApp --dir a/ ",
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			got := runCompleteArgs(t, kong.Must(&cli), td.line, options)
+			assert.Equal(t, td.want, got)
+		})
+	}
+
+	t.Run("files without rich format", func(t *testing.T) {
+		got := runComplete(t, kong.Must(&cli), "myApp --fallback "+dir+"/", options)
+		assert.ElementsMatch(t, []string{dir + "/", filepath.Join(dir, "a.txt")}, got)
+	})
+}
+
+func TestComplete_flagEquals(t *testing.T) {
+	var cli struct {
+		Verbose int               `kong:"type='counter',short='v'"`
+		Debug   bool              `kong:"negatable"`
+		Format  string            `kong:"help='Output format.',enum='json,text',default='text',short='f'"`
+		Label   map[string]string `kong:"predictor='labels'"`
+	}
+	options := []Option{
+		WithPredictor("labels", complete.PredictSet("env=prod", "env=dev", "team=a")),
+	}
+
+	for _, td := range []struct {
+		completeTest
+		rich    bool
+		options []Option
+	}{
+		{
+			completeTest: completeTest{
+				name: "value",
+				want: []string{"--format=json\t\t", ":"},
+				line: "myApp --format=j",
+			},
+			rich: true,
+		},
+		{
+			completeTest: completeTest{
+				name: "empty value",
+				want: []string{"--format=json\t\t", "--format=text\t\t", ":"},
+				line: "myApp --format=",
+			},
+			rich: true,
+		},
+		{
+			completeTest: completeTest{
+				name: "value with equals",
+				want: []string{"--label=env=prod\t\t", "--label=env=dev\t\t", ":"},
+				line: "myApp --label=env=",
+			},
+			rich: true,
+		},
+		{
+			completeTest: completeTest{
+				name: "plain",
+				want: []string{"json", "text"},
+				line: "myApp --format=",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "short flag",
+				want: []string{},
+				line: "myApp -f=",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "equals flag name",
+				want: []string{"--format=\tOutput format.\tFlags", ":nospace"},
+				line: "myApp --f",
+			},
+			rich:    true,
+			options: []Option{WithEqualsFlagNames()},
+		},
+		{
+			completeTest: completeTest{
+				name: "equals flag names",
+				want: []string{
+					"--help", "-h", "--verbose", "-v", "--debug", "--no-debug", "--format=", "-f", "--label=",
+				},
+				line: "myApp -",
+			},
+			options: []Option{WithEqualsFlagNames()},
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			run := runComplete
+			if td.rich {
+				run = runCompleteArgs
+			}
+			got := run(t, kong.Must(&cli), td.line, append(options, td.options...))
+			assert.ElementsMatch(t, td.want, got)
+		})
+	}
+}
+
+func TestComplete_elements(t *testing.T) {
+	var cli struct {
+		Tags   []string          `kong:"predictor='tags'"`
+		Colors []string          `kong:"enum='red,green,blue',sep=':'"`
+		Names  []string          `kong:"predictor='tags',sep='none'"`
+		Label  map[string]string `kong:"predictor='labels'"`
+		Files  []string          `kong:"type='path'"`
+	}
+	options := []Option{
+		WithPredictor("tags", PredictCandidates(
+			Candidate{Value: "a", Description: "A."},
+			Candidate{Value: "b", Description: "B."},
+			Candidate{Value: "c", Description: "C."},
+		)),
+		WithPredictor("labels", complete.PredictSet("env=prod", "env=dev", "team=a")),
+		WithPredictor("file", complete.PredictSet("file1", "file2")),
+	}
+
+	for _, td := range []struct {
+		completeTest
+		rich bool
+	}{
+		{
+			completeTest: completeTest{
+				name: "first element",
+				want: []string{"a", "b", "c"},
+				line: "myApp --tags ",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "next element",
+				want: []string{"a,b", "a,c"},
+				line: "myApp --tags a,",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "partial element",
+				want: []string{"a,c,b"},
+				line: "myApp --tags a,c,b",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "all present",
+				want: []string{},
+				line: "myApp --tags c,a,b,",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "rich",
+				want: []string{"--tags=a,b\tB.\t", "--tags=a,c\tC.\t", ":"},
+				line: "myApp --tags=a,",
+			},
+			rich: true,
+		},
+		{
+			completeTest: completeTest{
+				name: "sep",
+				want: []string{"blue"},
+				line: "myApp --colors red:b",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "no sep",
+				want: []string{},
+				line: "myApp --names a,",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "map keys present",
+				want: []string{"team=a"},
+				line: "myApp --label env=dev;",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "paths",
+				want: []string{"file2,file1"},
+				line: "myApp --files file2,",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "paths directive",
+				want: []string{"file2,file1\t\t", ":"},
+				line: "myApp --files file2,",
+			},
+			rich: true,
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			run := runComplete
+			if td.rich {
+				run = runCompleteArgs
+			}
+			got := run(t, kong.Must(&cli), td.line, options)
+			assert.ElementsMatch(t, td.want, got)
+		})
+	}
+}
+
+func TestComplete_mapPredictors(t *testing.T) {
+	var cli struct {
+		Label  map[string]string `kong:"predictor-key='keys',predictor-value='values'"`
+		Keys   map[string]string `kong:"predictor-key='keys'"`
+		Config map[string]string `kong:"predictor-key='keys',predictor-value='file'"`
+		Region string
+		Zones  map[string]string `kong:"predictor-value='zones'"`
+	}
+	options := []Option{
+		WithPredictor("keys", PredictCandidates(
+			Candidate{Value: "env", Description: "Environment."},
+			Candidate{Value: "team"},
+		)),
+		WithPredictor("values", MapValuePredictFunc(func(key string, a complete.Args) []string {
+			if key == "env" {
+				return []string{"prod", "dev"}
+			}
+			return []string{key + "1", key + "2"}
+		})),
+		WithPredictor("file", complete.PredictSet("file1", "file2")),
+		WithContextPredictor("zones", ContextPredictFunc(func(ctx *PredictContext) []string {
+			region, _ := ctx.Flags["region"].(string)
+			return []string{region + "-" + ctx.MapKey + "-1"}
+		})),
+	}
+
+	for _, td := range []struct {
+		completeTest
+		rich bool
+	}{
+		{
+			completeTest: completeTest{
+				name: "keys",
+				want: []string{"env=", "team="},
+				line: "myApp --label ",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "values",
+				want: []string{"prod", "dev"},
+				line: "myApp --label env=",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "rich values",
+				want: []string{"env=prod\t\t", "env=dev\t\t", ":"},
+				line: "myApp --label env=",
+			},
+			rich: true,
+		},
+		{
+			completeTest: completeTest{
+				name: "values for key",
+				want: []string{"team1"},
+				line: "myApp --label team=team1",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "next key",
+				want: []string{"team="},
+				line: "myApp --label env=dev;",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "next value",
+				want: []string{"team1", "team2"},
+				line: "myApp --label env=dev;team=",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "rich keys",
+				want: []string{"--label=env=\tEnvironment.\t", "--label=team=\t\t", ":nospace"},
+				line: "myApp --label=",
+			},
+			rich: true,
+		},
+		{
+			completeTest: completeTest{
+				name: "no value predictor",
+				want: []string{},
+				line: "myApp --keys env=",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "path values",
+				want: []string{"team=file1\t\t", "team=file2\t\t", ":"},
+				line: "myApp --config team=",
+			},
+			rich: true,
+		},
+		{
+			completeTest: completeTest{
+				name: "context values for key",
+				want: []string{"eu-web-1"},
+				line: "myApp --region eu --zones web=",
+			},
+		},
+		{
+			completeTest: completeTest{
+				name: "context values for next key",
+				want: []string{"eu-db-1"},
+				line: "myApp --region eu --zones web=eu-web-1;db=",
+			},
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			run := runComplete
+			if td.rich {
+				run = runCompleteArgs
+			}
+			got := run(t, kong.Must(&cli), td.line, options)
+			assert.ElementsMatch(t, td.want, got)
+		})
+	}
+
+	t.Run("not a map", func(t *testing.T) {
+		var cli struct {
+			Name string `kong:"predictor-key='keys'"`
+		}
+		_, err := Command(kong.Must(&cli), options...)
+		require.EqualError(t, err, "predictor-key and predictor-value tags are only supported for maps")
+	})
+
+	t.Run("unknown predictor", func(t *testing.T) {
+		var cli struct {
+			Label map[string]string `kong:"predictor-value='nope'"`
+		}
+		_, err := Command(kong.Must(&cli), options...)
+		require.EqualError(t, err, `no predictor with name "nope"`)
+	})
+}
+
+func TestComplete_completeCommand(t *testing.T) {
+	var cli struct {
+		Format string `kong:"help='Output format.',enum='json,text',default='text'"`
+		Config string `kong:"type='path'"`
+		Get    struct {
+			Name string `kong:"arg"`
+		} `kong:"cmd,help='Get things.'"`
+	}
+	withArgs := func(args ...string) Option {
+		return func(o *options) {
+			o.args = args
+		}
+	}
+	run := func(t *testing.T, opt ...Option) (output string, exited bool) {
+		t.Helper()
+		var buf bytes.Buffer
+		parser := kong.Must(&cli, kong.Name("myApp"), kong.Writers(&buf, &buf))
+		opt = append(opt,
+			WithErrorHandler(func(err error) {
+				t.Helper()
+				assert.NoError(t, err)
+			}),
+			WithExitFunc(func(code int) {
+				t.Helper()
+				assert.Equal(t, 0, code)
+				exited = true
+			}),
+		)
+		Complete(parser, opt...)
+		return buf.String(), exited
+	}
+
+	for _, td := range []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "commands",
+			args: []string{"__complete", ""},
+			want: "get\tGet things.\tCommands\n:\n",
+		},
+		{
+			name: "no args",
+			args: []string{"__complete"},
+			want: "get\tGet things.\tCommands\n:\n",
+		},
+		{
+			name: "flags",
+			args: []string{"__complete", "get", "--f"},
+			want: "--format\tOutput format.\tFlags\n:\n",
+		},
+		{
+			name: "flag value",
+			args: []string{"__complete", "--format", "j"},
+			want: "json\t\t\n:\n",
+		},
+		{
+			name: "equals value",
+			args: []string{"__complete", "--format=t"},
+			want: "--format=text\t\t\n:\n",
+		},
+		{
+			name: "words with spaces",
+			args: []string{"__complete", "get", "a b", ""},
+			want: ":\n",
+		},
+		{
+			name: "files",
+			args: []string{"__complete", "--config", ""},
+			want: ":files *\n",
+		},
+	} {
+		t.Run(td.name, func(t *testing.T) {
+			t.Setenv(envLine, "")
+			got, exited := run(t, withArgs(td.args...))
+			assert.True(t, exited)
+			assert.Equal(t, td.want, got)
+		})
+	}
+
+	t.Run("COMP_LINE", func(t *testing.T) {
+		t.Setenv(envLine, "myApp --format ")
+		got, exited := run(t, withArgs("--format"))
+		assert.True(t, exited)
+		assert.Equal(t, "json\ntext\n", got)
+	})
+
+	t.Run("COMP_LINE without complete command", func(t *testing.T) {
+		t.Setenv(envLine, "myApp --format ")
+		got, exited := run(t, withArgs("--format"), WithCompleteCommand())
+		assert.False(t, exited)
+		assert.Empty(t, got)
+	})
+
+	t.Run("args over COMP_LINE", func(t *testing.T) {
+		t.Setenv(envLine, "other get ")
+		for _, opt := range [][]Option{nil, {WithCompleteCommand()}} {
+			got, exited := run(t, append(opt, withArgs("__complete", "--format", ""))...)
+			assert.True(t, exited)
+			assert.Equal(t, "json\t\t\ntext\t\t\n:\n", got)
+		}
+	})
+
+	t.Run("not completing", func(t *testing.T) {
+		t.Setenv(envLine, "")
+		got, exited := run(t, withArgs("get", "foo"))
+		assert.False(t, exited)
+		assert.Empty(t, got)
+	})
+}
+
 func Test_tagPredictor(t *testing.T) {
 	t.Run("nil", func(t *testing.T) {
 		got, err := tagPredictor(nil, nil)
@@ -174,17 +1371,29 @@ func Test_tagPredictor(t *testing.T) {
 	})
 
 	t.Run("missing predictor", func(t *testing.T) {
-		got, err := tagPredictor(testTag{predictorTag: "foo"}, nil)
+		got, err := tagPredictor(testTag{predictorTag: "foo"}, &options{})
 		assert.Error(t, err)
 		assert.Equal(t, `no predictor with name "foo"`, err.Error())
 		assert.Nil(t, got)
 	})
 
 	t.Run("existing predictor", func(t *testing.T) {
-		got, err := tagPredictor(testTag{predictorTag: "foo"}, map[string]complete.Predictor{"foo": complete.PredictAnything})
+		got, err := tagPredictor(testTag{predictorTag: "foo"}, &options{
+			predictors: map[string]complete.Predictor{"foo": complete.PredictAnything},
+		})
 		assert.NoError(t, err)
 		assert.NotNil(t, got)
 	})
+
+	t.Run("context predictor", func(t *testing.T) {
+		predictor := ContextPredictFunc(func(*PredictContext) []string { return nil })
+		got, err := tagPredictor(testTag{predictorTag: "foo"}, &options{
+			predictors:        map[string]complete.Predictor{"foo": complete.PredictAnything},
+			contextPredictors: map[string]ContextPredictor{"foo": predictor},
+		})
+		assert.NoError(t, err)
+		assert.IsType(t, &contextPredictor{}, got)
+	})
 }
 
 type testTag map[string]string
@@ -246,6 +1455,16 @@ func runComplete(t *testing.T, parser *kong.Kong, line string, options []Option)
 	return parseOutput(buf.String())
 }
 
+// runCompleteArgs is like runComplete, but it completes line with "__complete <args...>" like the generated scripts
+// do, so the output is in the rich format.
+func runCompleteArgs(t *testing.T, parser *kong.Kong, line string, opts []Option) []string {
+	t.Helper()
+	args := append([]string{completeCmd}, completeArgs(line)...)
+	return runComplete(t, parser, "", append(opts, func(o *options) {
+		o.args = args
+	}))
+}
+
 func parseOutput(output string) []string {
 	lines := strings.Split(output, "\n")
 	options := []string{}
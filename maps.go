@@ -0,0 +1,106 @@
+package kongplete
+
+import (
+	"strings"
+
+	"github.com/posener/complete"
+)
+
+const (
+	// keyPredictorTag and valuePredictorTag name the predictors for the keys and values of a map.
+	keyPredictorTag   = "predictor-key"
+	valuePredictorTag = "predictor-value"
+)
+
+// MapValuePredictor can be used as the predictor-value predictor of a map to predict values that depend on their
+// key. A ContextPredictor can be used too, and it gets the key from PredictContext.MapKey.
+type MapValuePredictor interface {
+	PredictMapValue(key string, a complete.Args) []string
+}
+
+// MapValuePredictFunc is a function that implements MapValuePredictor.
+type MapValuePredictFunc func(key string, a complete.Args) []string
+
+// PredictMapValue implements MapValuePredictor
+func (f MapValuePredictFunc) PredictMapValue(key string, a complete.Args) []string {
+	if f == nil {
+		return nil
+	}
+	return f(key, a)
+}
+
+// Predict implements complete.Predictor. It predicts values for an empty key.
+func (f MapValuePredictFunc) Predict(a complete.Args) []string {
+	return f.PredictMapValue("", a)
+}
+
+// mapPredictor predicts a "key=value" map element: keys followed by "=" until the "=" is typed, then the values
+// for the key. Either predictor may be nil.
+type mapPredictor struct {
+	key   complete.Predictor
+	value complete.Predictor
+}
+
+// Predict implements complete.Predictor
+func (p *mapPredictor) Predict(a complete.Args) []string {
+	candidates := p.PredictDescribed(a)
+	values := make([]string, len(candidates))
+	for i, c := range candidates {
+		values[i] = c.Value
+	}
+	return values
+}
+
+// PredictDescribed implements DescribedPredictor
+func (p *mapPredictor) PredictDescribed(a complete.Args) []Candidate {
+	key, va, ok := p.split(a)
+	if !ok {
+		return p.predictKeys(a)
+	}
+	return withPrefix(describedPredictions(p.valuePredictor(key), va), key+"=")
+}
+
+// split splits the last arg into the key and args to predict the value being typed with. ok is false until the
+// "=" after the key is typed.
+func (p *mapPredictor) split(a complete.Args) (key string, va complete.Args, ok bool) {
+	va = a
+	key, va.Last, ok = strings.Cut(a.Last, "=")
+	return key, va, ok
+}
+
+// predictKeys predicts the keys followed by "=".
+func (p *mapPredictor) predictKeys(a complete.Args) []Candidate {
+	keys := describedPredictions(p.key, a)
+	candidates := make([]Candidate, len(keys))
+	for i, c := range keys {
+		c.Value += "="
+		candidates[i] = c
+	}
+	return candidates
+}
+
+// valuePredictor returns the predictor for the values of key. MapValuePredictors and context predictors are given
+// the key.
+func (p *mapPredictor) valuePredictor(key string) complete.Predictor {
+	switch vp := p.value.(type) {
+	case MapValuePredictor:
+		return complete.PredictFunc(func(a complete.Args) []string {
+			return vp.PredictMapValue(key, a)
+		})
+	case *contextPredictor:
+		withKey := *vp
+		withKey.mapKey = key
+		return &withKey
+	}
+	return p.value
+}
+
+// withPrefix returns the candidates with prefix added to their values.
+func withPrefix(candidates []Candidate, prefix string) []Candidate {
+	res := make([]Candidate, len(candidates))
+	for i, c := range candidates {
+		c.Value = prefix + c.Value
+		res[i] = c
+	}
+	return res
+}
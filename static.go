@@ -0,0 +1,369 @@
+package kongplete
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"github.com/posener/complete"
+)
+
+// StaticScript returns a completion script for shell that completes parser's commands, flags, aliases and enum
+// values without running bin. Values with other predictors, like those from WithPredictor, still run bin, which
+// must call Complete with the same options. Only bash and zsh are supported.
+func StaticScript(parser *kong.Kong, shell, bin string, opt ...Option) (string, error) {
+	if name := shellName(shell); name != "bash" && name != "zsh" {
+		return "", fmt.Errorf("static scripts aren't supported for %s", shell)
+	}
+	opts := buildOptions(opt...)
+	if parser == nil || parser.Model == nil {
+		return "", fmt.Errorf("no kong model to generate a script from")
+	}
+	opts.trace.parser = parser
+	root, err := nodeCommand(parser.Model.Node, opts)
+	if err != nil {
+		return "", err
+	}
+	cmd := parser.Model.Name
+	core := "_" + identifier(cmd) + "_kongplete"
+	g := &staticGenerator{core: core, bin: bin}
+	g.walk(root, nil)
+	// The shell's script runs the core function the way it would run bin.
+	script, err := completionScript(shell, cmd, core)
+	if err != nil {
+		return "", err
+	}
+	return g.generate() + "\n" + script, nil
+}
+
+// staticCommand is a command in a static script.
+type staticCommand struct {
+	id     int
+	cmd    *command
+	parent *staticCommand
+}
+
+// staticGenerator generates the core function of a static script. The core function is run like "bin __complete
+// <args...>" and writes the same rich format as Complete, running bin for anything it can't predict itself.
+type staticGenerator struct {
+	core     string
+	bin      string
+	commands []*staticCommand
+}
+
+// walk adds cmd and its sub-commands to g.commands.
+func (g *staticGenerator) walk(cmd *command, parent *staticCommand) {
+	sc := &staticCommand{id: len(g.commands), cmd: cmd, parent: parent}
+	g.commands = append(g.commands, sc)
+	for _, name := range sortedSubNames(cmd) {
+		sub := cmd.sub[name]
+		if g.find(sub) == nil {
+			g.walk(sub, sc)
+		}
+	}
+}
+
+// find returns the staticCommand for cmd.
+func (g *staticGenerator) find(cmd *command) *staticCommand {
+	for _, sc := range g.commands {
+		if sc.cmd == cmd {
+			return sc
+		}
+	}
+	return nil
+}
+
+// sortedSubNames returns the names and aliases of cmd's sub-commands in order.
+func sortedSubNames(cmd *command) []string {
+	names := make([]string, 0, len(cmd.sub))
+	for name := range cmd.sub {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// generate returns the core function and its helpers.
+func (g *staticGenerator) generate() string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, `%[1]s_bin() {
+  %[2]s __complete "${args[@]}" 2>/dev/null
+}
+
+%[1]s_add() {
+  [[ $1 == "$cur"* ]] || return 0
+  [[ -z $sep || $present != *"$sep$1$sep"* ]] || return 0
+  printf '%%s\t%%s\t%%s\n' "$prefix$1" "$2" "$3"
+  (( ++matched ))
+  [[ $1 != *= ]] || (( ++equals ))
+}
+
+# Like kongplete, complete the element of a slice after the last separator $1 and leave out the elements already
+# typed.
+%[1]s_elements() {
+  [[ $cur == *"$1"* ]] || return 0
+  sep=$1
+  present=$sep${cur%%"$sep"*}$sep
+  prefix=$prefix${cur%%"$sep"*}$sep
+  cur=${cur##*"$sep"}
+}
+
+%[1]s() {
+  [[ -n ${ZSH_VERSION-} ]] && emulate -L ksh
+  local word cur prev= prefix= sep= present= directive= cmd=0 start=0 i pos=0 end=0 matched=0 equals=0
+  local -a args completed
+  # Like bin, it is run as "__complete <args...>".
+  shift
+  args=("$@")
+  (( ${#args[@]} )) || args=("")
+  cur=${args[${#args[@]}-1]}
+  for ((i = 0; i < ${#args[@]} - 1; i++)); do
+    completed[${#completed[@]}]=${args[i]}
+  done
+  # Like kongplete, complete the value of --flag=value and keep the flag in the candidates.
+  if [[ $cur == --?*=* ]]; then
+    prefix=${cur%%%%=*}=
+    completed[${#completed[@]}]=${cur%%%%=*}
+    cur=${cur#*=}
+  fi
+  (( ${#completed[@]} )) && prev=${completed[${#completed[@]}-1]}
+`, g.core, shellQuote(g.bin))
+
+	b.WriteString(`  for ((i = 0; i < ${#completed[@]}; i++)); do
+    case "$cmd ${completed[i]}" in
+`)
+	for _, sc := range g.commands {
+		for _, name := range sortedSubNames(sc.cmd) {
+			sub := g.find(sc.cmd.sub[name])
+			fmt.Fprintf(b, "      %s) cmd=%d start=$((i + 1)) ;;\n", shellQuote(fmt.Sprintf("%d %s", sc.id, name)), sub.id)
+		}
+	}
+	b.WriteString(`    esac
+  done
+`)
+
+	var passthrough []string
+	for _, sc := range g.commands {
+		if sc.cmd.passthrough || sc.cmd.args.Passthrough {
+			passthrough = append(passthrough, fmt.Sprint(sc.id))
+		}
+	}
+	if len(passthrough) > 0 {
+		fmt.Fprintf(b, `  case $cmd in
+    %s) %s_bin; return ;;
+  esac
+`, strings.Join(passthrough, " | "), g.core)
+	}
+
+	fmt.Fprintf(b, `  for ((i = start; i < ${#completed[@]}; i++)); do
+    word=${completed[i]}
+    if (( ! end )); then
+      [[ $word == -- ]] && { end=1; continue; }
+      [[ $word == -[!-]?* ]] && { %s_bin; return; }
+      case "$cmd $word" in
+`, g.core)
+	for _, sc := range g.commands {
+		var argFlags, flags []string
+		for _, name := range sc.cmd.args.ArgFlags {
+			key := fmt.Sprintf("%d %s", sc.id, name)
+			if strings.HasPrefix(name, "--") {
+				flags = append(flags, shellQuote(key+"=")+"*")
+			}
+			argFlags = append(argFlags, shellQuote(key))
+		}
+		for _, name := range sc.cmd.args.BoolFlags {
+			key := fmt.Sprintf("%d %s", sc.id, name)
+			if strings.HasPrefix(name, "--") {
+				flags = append(flags, shellQuote(key+"=")+"*")
+			}
+			flags = append(flags, shellQuote(key))
+		}
+		if len(argFlags) > 0 {
+			fmt.Fprintf(b, "        %s) ((++i)); continue ;;\n", strings.Join(argFlags, " | "))
+		}
+		if len(flags) > 0 {
+			fmt.Fprintf(b, "        %s) continue ;;\n", strings.Join(flags, " | "))
+		}
+	}
+	b.WriteString(`      esac
+    fi
+    ((++pos))
+  done
+`)
+	// The last predictor of a cumulative argument predicts every position after it.
+	var cumulative []string
+	for _, sc := range g.commands {
+		if n := len(sc.cmd.args.Predictors); n > 0 && sc.cmd.args.IsCumulative {
+			cumulative = append(cumulative, fmt.Sprintf("    %d) (( pos > %d )) && pos=%d ;;\n", sc.id, n-1, n-1))
+		}
+	}
+	if len(cumulative) > 0 {
+		fmt.Fprintf(b, "  case $cmd in\n%s  esac\n", strings.Join(cumulative, ""))
+	}
+	b.WriteString(`  if (( end )); then
+`)
+	g.writeArgs(b, "    ")
+	b.WriteString(`  else
+    case "$cmd $prev" in
+`)
+	for _, sc := range g.commands {
+		for _, name := range g.valueFlagNames(sc) {
+			predictor, _ := sc.cmd.flag(name)
+			fmt.Fprintf(b, "      %s)\n", shellQuote(fmt.Sprintf("%d %s", sc.id, name)))
+			g.writePredictor(b, "        ", predictor)
+			b.WriteString("        ;;\n")
+		}
+	}
+	fmt.Fprintf(b, `      *)
+        [[ $prev == -[!-]?* || $cur == -[!-]?* ]] && { %[1]s_bin; return; }
+`, g.core)
+	g.writeDynamicArgs(b, "        ")
+	b.WriteString(`        if [[ $cur == -* ]]; then
+          case $cmd in
+`)
+	for _, sc := range g.commands {
+		var candidates []Candidate
+		for c := sc; c != nil; c = c.parent {
+			candidates = append(candidates, c.cmd.flagNames...)
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "            %d)\n", sc.id)
+		g.writeCandidates(b, "              ", candidates)
+		b.WriteString("              ;;\n")
+	}
+	b.WriteString(`          esac
+        fi
+        case $cmd in
+`)
+	for _, sc := range g.commands {
+		if len(sc.cmd.subNames) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "          %d)\n", sc.id)
+		g.writeCandidates(b, "            ", sc.cmd.subNames)
+		b.WriteString("            ;;\n")
+	}
+	b.WriteString(`        esac
+`)
+	g.writeArgs(b, "        ")
+	b.WriteString(`        ;;
+    esac
+  fi
+  (( matched && matched == equals )) && directive="nospace${directive:+ $directive}"
+  printf ':%s\n' "$directive"
+}
+`)
+	return b.String()
+}
+
+// valueFlagNames returns the names of flags that take values from sc and its ancestors. Like complete, the
+// nearest command's flag wins.
+func (g *staticGenerator) valueFlagNames(sc *staticCommand) []string {
+	seen := map[string]bool{}
+	var names []string
+	for c := sc; c != nil; c = c.parent {
+		for _, candidate := range c.cmd.flagNames {
+			// Flag names suggested with WithEqualsFlagNames end with "=".
+			name := strings.TrimSuffix(candidate.Value, "=")
+			if seen[name] || c.cmd.flags[name] == nil {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// writeArgs writes the predictions for the positional argument at $pos.
+func (g *staticGenerator) writeArgs(b *strings.Builder, indent string) {
+	fmt.Fprintf(b, "%scase \"$cmd $pos\" in\n", indent)
+	for _, sc := range g.commands {
+		args := sc.cmd.args
+		for i, predictor := range args.Predictors {
+			pattern := shellQuote(fmt.Sprintf("%d %d", sc.id, i))
+			fmt.Fprintf(b, "%s  %s)\n", indent, pattern)
+			g.writePredictor(b, indent+"    ", predictor)
+			fmt.Fprintf(b, "%s    ;;\n", indent)
+		}
+	}
+	fmt.Fprintf(b, "%sesac\n", indent)
+}
+
+// writeDynamicArgs writes a check that runs bin when the positional argument at $pos has a dynamic predictor.
+func (g *staticGenerator) writeDynamicArgs(b *strings.Builder, indent string) {
+	var patterns []string
+	for _, sc := range g.commands {
+		args := sc.cmd.args
+		for i, predictor := range args.Predictors {
+			if _, _, ok := staticPrediction(predictor); ok {
+				continue
+			}
+			pattern := shellQuote(fmt.Sprintf("%d %d", sc.id, i))
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "%scase \"$cmd $pos\" in\n%s  %s) %s_bin; return ;;\n%sesac\n",
+		indent, indent, strings.Join(patterns, " | "), g.core, indent)
+}
+
+// writePredictor writes the predictions of a value predictor, running bin for dynamic predictors.
+func (g *staticGenerator) writePredictor(b *strings.Builder, indent string, predictor complete.Predictor) {
+	candidates, files, ok := staticPrediction(predictor)
+	if elements, isElements := predictor.(*elementsPredictor); ok && isElements {
+		// Paths are completed by the shell, which can't complete them after a separator.
+		if files != nil {
+			fmt.Fprintf(b, "%s[[ $cur == *%s* ]] && { %s_bin; return; }\n", indent, shellQuote(elements.sep), g.core)
+		} else if len(candidates) > 0 {
+			fmt.Fprintf(b, "%s%s_elements %s\n", indent, g.core, shellQuote(elements.sep))
+		}
+	}
+	switch {
+	case !ok:
+		fmt.Fprintf(b, "%s%s_bin; return\n", indent, g.core)
+	case files != nil:
+		fmt.Fprintf(b, "%sdirective=%s\n", indent, shellQuote(files.directive()))
+	default:
+		g.writeCandidates(b, indent, candidates)
+	}
+}
+
+// writeCandidates writes candidates in the rich format.
+func (g *staticGenerator) writeCandidates(b *strings.Builder, indent string, candidates []Candidate) {
+	for _, c := range candidates {
+		fmt.Fprintf(b, "%s%s_add %s %s %s\n", indent, g.core,
+			shellQuote(c.Value), shellQuote(oneLine(c.Description)), shellQuote(oneLine(c.Group)))
+	}
+}
+
+// staticPrediction returns the predictions of predictor when they are known without running it. ok is false
+// for dynamic predictors.
+func staticPrediction(predictor complete.Predictor) (candidates []Candidate, files *filesPredictor, ok bool) {
+	switch p := predictor.(type) {
+	case nil:
+		return nil, nil, true
+	case predictCandidates:
+		return p, nil, true
+	case *filesPredictor:
+		return nil, p, true
+	case *elementsPredictor:
+		// The elements of slices are split off in the script, but leaving out the present keys of maps isn't.
+		if p.isMap {
+			return nil, nil, false
+		}
+		return staticPrediction(p.predictor)
+	default:
+		return nil, nil, false
+	}
+}
+
+// shellQuote quotes s for bash and zsh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,277 @@
+package kongplete
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/posener/complete"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const envStaticHelper = "KONGPLETE_STATIC_HELPER"
+
+type staticCLI struct {
+	Verbose bool     `short:"v" help:"Be loud."`
+	Format  string   `short:"f" enum:"json,text" default:"text" help:"Output format." group:"Output"`
+	Color   bool     `negatable:"" help:"Colorize 'output'."`
+	Secret  string   `hidden:""`
+	Name    string   `aliases:"nm" predictor:"names"`
+	Config  string   `type:"path"`
+	Tags    []string `enum:"a,b,c"`
+
+	Get struct {
+		Kind  string   `arg:"" enum:"pod,node"`
+		Names []string `arg:"" optional:"" predictor:"names"`
+		All   bool     `short:"a"`
+	} `cmd:"" aliases:"g" help:"Get things." group:"Read"`
+
+	Put struct {
+		Dir   string `arg:"" type:"existingdir"`
+		Force bool
+	} `cmd:""`
+
+	Exec struct {
+		Args []string `arg:"" passthrough:""`
+	} `cmd:""`
+
+	Hidden struct{} `cmd:"" hidden:""`
+
+	Nested struct {
+		Deep struct {
+			Level int `enum:"1,2" default:"1"`
+		} `cmd:""`
+	} `cmd:""`
+}
+
+func newStaticParser(t *testing.T) *kong.Kong {
+	t.Helper()
+	var cli staticCLI
+	parser, err := kong.New(&cli, kong.Name("app"))
+	require.NoError(t, err)
+	return parser
+}
+
+func staticOptions() []Option {
+	return []Option{
+		WithPredictor("names", complete.PredictSet("alice", "bob")),
+	}
+}
+
+// TestStaticScript_helper is the binary the scripts run in tests. See writeHelperBin.
+func TestStaticScript_helper(t *testing.T) {
+	if os.Getenv(envStaticHelper) == "" {
+		t.Skip("only run by TestStaticScript")
+	}
+	// The script's args are passed after "--".
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	withArgs := func(o *options) {
+		o.args = args
+	}
+	Complete(newStaticParser(t), append(staticOptions(), WithExitFunc(os.Exit), withArgs)...)
+}
+
+func TestStaticScript(t *testing.T) {
+	testStaticScript(t, "bash", "bash")
+}
+
+// testStaticScript checks that shell's static script gives the same results as Complete when it is run by run, and
+// only runs the binary for values it can't predict. When run isn't shell, only the core function is run.
+func testStaticScript(t *testing.T, shell, run string) {
+	t.Helper()
+	if _, err := exec.LookPath(run); err != nil {
+		t.Skip(run + " is required")
+	}
+	dir := t.TempDir()
+	callLog := filepath.Join(dir, "calls")
+	bin := writeHelperBin(t, dir, callLog)
+
+	script, err := StaticScript(newStaticParser(t), shell, bin, staticOptions()...)
+	require.NoError(t, err)
+	if run != shell {
+		script = staticCore(t, script, shell)
+	}
+	scriptFile := filepath.Join(dir, "app."+shell)
+	writeFile(t, scriptFile, script)
+
+	for _, td := range []struct {
+		line    string
+		dynamic bool
+	}{
+		{line: "app "},
+		{line: "app -"},
+		{line: "app --"},
+		{line: "app --f"},
+		{line: "app --format "},
+		{line: "app --format="},
+		{line: "app --format=j"},
+		{line: "app -f "},
+		{line: "app -v -f t"},
+		{line: "app --no-color "},
+		{line: "app --config "},
+		{line: "app --tags "},
+		{line: "app --tags a,"},
+		{line: "app --tags a,b"},
+		{line: "app --tags=a,c,"},
+		{line: "app --secret x "},
+		{line: "app --name ", dynamic: true},
+		{line: "app --nm a", dynamic: true},
+		{line: "app -vf ", dynamic: true},
+		{line: "app -vfj", dynamic: true},
+		{line: "app g"},
+		{line: "app get "},
+		{line: "app g -"},
+		{line: "app get -a "},
+		{line: "app -v get --all n"},
+		{line: "app get pod ", dynamic: true},
+		{line: "app get pod alice ", dynamic: true},
+		{line: "app get pod --format "},
+		{line: "app get -- "},
+		{line: "app get -- -"},
+		{line: "app put "},
+		{line: "app put -"},
+		{line: "app exec ", dynamic: true},
+		{line: "app exec ls -", dynamic: true},
+		{line: "app nested "},
+		{line: "app nested deep --level "},
+		{line: "app nested deep -"},
+		{line: "app hidden "},
+		{line: "app unknown "},
+	} {
+		t.Run(td.line, func(t *testing.T) {
+			want := runCompleteArgs(t, newStaticParser(t), td.line, staticOptions())
+
+			require.NoError(t, os.RemoveAll(callLog))
+			// compdef is only defined once zsh's completion system is loaded.
+			cmd := exec.Command(run, append([]string{"-c", `compdef() { :; }
+source "$1" && shift && _app_kongplete __complete "$@"`, run, scriptFile}, completeArgs(td.line)...)...)
+			cmd.Stderr = os.Stderr
+			out, err := cmd.Output()
+			require.NoError(t, err)
+			assert.ElementsMatch(t, want, parseOutput(string(out)))
+			if td.dynamic {
+				assert.FileExists(t, callLog, "expected the script to run the binary")
+			} else {
+				assert.NoFileExists(t, callLog, "expected the script not to run the binary")
+			}
+		})
+	}
+}
+
+func TestStaticScript_equalsFlagNames(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is required")
+	}
+	options := append(staticOptions(), WithEqualsFlagNames())
+	script, err := StaticScript(newStaticParser(t), "bash", "app", options...)
+	require.NoError(t, err)
+	scriptFile := filepath.Join(t.TempDir(), "app.bash")
+	writeFile(t, scriptFile, script)
+
+	for _, line := range []string{
+		"app -",
+		"app --f",
+		"app --format=",
+		"app --format=t",
+		"app --con",
+		"app get --",
+		"app nested deep --l",
+	} {
+		t.Run(line, func(t *testing.T) {
+			want := runCompleteArgs(t, newStaticParser(t), line, options)
+			cmd := exec.Command("bash", append([]string{"-c", `source "$1" && shift && _app_kongplete __complete "$@"`, "bash", scriptFile},
+				completeArgs(line)...)...)
+			cmd.Stderr = os.Stderr
+			out, err := cmd.Output()
+			require.NoError(t, err)
+			assert.ElementsMatch(t, want, parseOutput(string(out)))
+		})
+	}
+}
+
+func TestStaticScript_bashCompletion(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is required")
+	}
+	script, err := StaticScript(newStaticParser(t), "bash", "app", staticOptions()...)
+	require.NoError(t, err)
+	scriptFile := filepath.Join(t.TempDir(), "app.bash")
+	writeFile(t, scriptFile, script)
+	cmd := exec.Command("bash", "-c", `source "$1"
+COMP_LINE="app --format=j" COMP_POINT=14 COMP_WORDS=(app --format = j) COMP_CWORD=3
+_app
+printf '%s\n' "${COMPREPLY[@]}"`, "bash", scriptFile)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	require.NoError(t, err)
+	assert.Equal(t, "json\n", string(out))
+}
+
+func TestStaticScript_zsh(t *testing.T) {
+	script, err := StaticScript(newStaticParser(t), "/bin/zsh", "app", staticOptions()...)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(script, "_app_kongplete_bin() {\n  'app' __complete \"${args[@]}\" 2>/dev/null\n}\n"))
+	assert.Contains(t, script, "'_app_kongplete' __complete \"${(@Q)words[2,CURRENT]}\" 2>/dev/null")
+	assert.Contains(t, script, "compdef _app app\n")
+
+	t.Run("same core as bash", func(t *testing.T) {
+		bashScript, err := StaticScript(newStaticParser(t), "bash", "app", staticOptions()...)
+		require.NoError(t, err)
+		assert.Equal(t, staticCore(t, bashScript, "bash"), staticCore(t, script, "zsh"))
+	})
+
+	// The core function runs in zsh's ksh emulation, so bash can check its tables without zsh.
+	t.Run("core same as Complete", func(t *testing.T) {
+		testStaticScript(t, "zsh", "bash")
+	})
+
+	t.Run("same as Complete", func(t *testing.T) {
+		testStaticScript(t, "zsh", "zsh")
+	})
+}
+
+// staticCore returns the core function and its helpers from a static script for shell.
+func staticCore(t *testing.T, script, shell string) string {
+	t.Helper()
+	wrapper, err := completionScript(shell, "app", "_app_kongplete")
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(script, "\n"+wrapper))
+	return strings.TrimSuffix(script, "\n"+wrapper)
+}
+
+// writeHelperBin writes an "app" binary to dir that runs Complete for staticCLI like a real binary would, and
+// appends a line to callLog every time it is run. It returns the path to the binary.
+func writeHelperBin(t *testing.T, dir, callLog string) string {
+	t.Helper()
+	testBin, err := os.Executable()
+	require.NoError(t, err)
+	bin := filepath.Join(dir, "app")
+	writeFile(t, bin, "#!/bin/sh\necho >> "+shellQuote(callLog)+"\n"+
+		envStaticHelper+"=1 exec "+shellQuote(testBin)+" -test.run='^TestStaticScript_helper$' -- \"$@\"\n")
+	require.NoError(t, os.Chmod(bin, 0o700))
+	return bin
+}
+
+// completeArgs returns the args a script runs "app __complete" with to complete line.
+func completeArgs(line string) []string {
+	args := strings.Fields(line)[1:]
+	if strings.HasSuffix(line, " ") {
+		args = append(args, "")
+	}
+	return args
+}
+
+func TestStaticScript_unsupportedShell(t *testing.T) {
+	_, err := StaticScript(newStaticParser(t), "fish", "app")
+	require.EqualError(t, err, "static scripts aren't supported for fish")
+}